@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/appleboy/BitbucketServer2Gitea/migration"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	auditOutput  string
+	auditTimeout string
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&projectKey, "project-key", "", "the parent project key")
+	auditCmd.Flags().StringVar(&repoSlug, "repo-slug", "", "the repository slug")
+	auditCmd.Flags().StringVar(&manifestFile, "manifest", "", "yaml or csv manifest file listing the repositories to audit")
+	auditCmd.Flags().StringVar(&workspace, "workspace", "", "workspace folder for the repository clones (default is system temp folder)")
+	auditCmd.Flags().StringVar(&protocol, "clone-protocol", "http", "bitbucket clone link protocol, http or ssh")
+	auditCmd.Flags().StringVarP(&auditOutput, "output", "o", "", "write the audit report as json file, used by migrate --audit-report")
+	auditCmd.Flags().StringVarP(&auditTimeout, "timeout", "t", "1h", "timeout for the audit")
+	auditCmd.Flags().Int64("max-file-size", 100, "largest file size in MiB allowed in the history")
+	auditCmd.Flags().Int64("max-repo-size", 2048, "largest packed repository size in MiB")
+	auditCmd.Flags().Int("max-commits", 100000, "largest number of commits")
+	auditCmd.Flags().String("block-on", string(migration.RiskHigh), "block the repositories with this risk or higher, medium or high")
+	_ = viper.BindPFlag("audit.max-file-size", auditCmd.Flags().Lookup("max-file-size"))
+	_ = viper.BindPFlag("audit.max-repo-size", auditCmd.Flags().Lookup("max-repo-size"))
+	_ = viper.BindPFlag("audit.max-commits", auditCmd.Flags().Lookup("max-commits"))
+	_ = viper.BindPFlag("audit.block-on", auditCmd.Flags().Lookup("block-on"))
+	rootCmd.AddCommand(auditCmd)
+}
+
+// auditCmd scans the repositories before the migration
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "scan the repositories for large files, missing lfs pointers, huge histories and secrets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout, err := time.ParseDuration(auditTimeout)
+		if err != nil {
+			return err
+		}
+		blockOn, err := migration.ParseRisk(viper.GetString("audit.block-on"))
+		if err != nil {
+			return err
+		}
+		if protocol != "http" && protocol != "ssh" {
+			return fmt.Errorf("clone protocol %q invalid", protocol)
+		}
+
+		manifest, err := loadManifest(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		m, err := migration.NewMigration(
+			ctx,
+			migration.Option{
+				Debug:         debug,
+				Workspace:     workspace,
+				CloneProtocol: protocol,
+				SourceOnly:    true,
+				Naming: migration.NamingOption{
+					Owner:       viper.GetString("naming.owner"),
+					Repo:        viper.GetString("naming.repo"),
+					Replacement: viper.GetString("naming.replacement"),
+				},
+				Archived: migration.ArchivedOption{
+					Skip: viper.GetBool("archived.skip"),
+					Org:  viper.GetString("archived.org"),
+				},
+			})
+		if err != nil {
+			return err
+		}
+
+		entries, err := m.Plan(manifest)
+		if err != nil {
+			return fmt.Errorf("invalid manifest:\n%w", err)
+		}
+
+		reports := m.Audit(entries, migration.AuditOption{
+			MaxFileSize: viper.GetInt64("audit.max-file-size") << 20,
+			MaxRepoSize: viper.GetInt64("audit.max-repo-size") << 20,
+			MaxCommits:  viper.GetInt("audit.max-commits"),
+			BlockOn:     blockOn,
+		})
+		blocked := printAuditReports(reports)
+
+		if auditOutput != "" {
+			if err := migration.WriteAuditReports(auditOutput, reports); err != nil {
+				return err
+			}
+			fmt.Println("audit report written to " + auditOutput)
+		}
+		if blocked > 0 {
+			return fmt.Errorf("%d of %d repositories blocked", blocked, len(reports))
+		}
+
+		return nil
+	},
+}
+
+// printAuditReports prints the risk of each repository with the findings
+// and returns the number of blocked repositories.
+func printAuditReports(reports []migration.AuditReport) int {
+	blocked := 0
+	for _, r := range reports {
+		summary := fmt.Sprintf("%s: %d commits, %.1f MiB", r.Source, r.Commits, float64(r.Size)/(1<<20))
+		status := "OK"
+		if r.Risk != migration.RiskNone {
+			status = fmt.Sprintf("%s RISK", r.Risk)
+		}
+		if r.Blocked {
+			blocked++
+			status += ", BLOCKED"
+		}
+
+		switch {
+		case r.Error != "":
+			color.Red("[ERROR] %s: %s", r.Source, r.Error)
+		case r.Risk == migration.RiskHigh:
+			color.Red("[%s] %s", status, summary)
+		case r.Risk == migration.RiskMedium:
+			color.Yellow("[%s] %s", status, summary)
+		default:
+			color.Green("[%s] %s", status, summary)
+		}
+
+		for _, f := range r.Findings {
+			if f.Path != "" {
+				fmt.Printf("  - %s (%s) %s: %s\n", f.Check, f.Risk, f.Path, f.Message)
+			} else {
+				fmt.Printf("  - %s (%s): %s\n", f.Check, f.Risk, f.Message)
+			}
+		}
+		if r.Omitted > 0 {
+			fmt.Printf("  ... %d more findings\n", r.Omitted)
+		}
+	}
+	return blocked
+}
@@ -18,13 +18,23 @@ var rootCmd = &cobra.Command{
 	SilenceUsage:  true,
 	Args:          cobra.MaximumNArgs(1),
 	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// config commands can create the missing profile
+		if cmd.Parent() == configCmd {
+			return nil
+		}
+		return profileErr
+	},
 }
 
 // Used for flags.
 var (
-	cfgFile  string
-	debug    bool
-	replacer = strings.NewReplacer("-", "_", ".", "_")
+	cfgFile       string
+	debug         bool
+	profile       string
+	activeProfile string
+	profileErr    error
+	replacer      = strings.NewReplacer("-", "_", ".", "_")
 )
 
 func init() {
@@ -32,6 +42,7 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/bitbucketServer2Gitea/.config.yaml)")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "debug mode")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "config profile name (default is the profile set by config use-profile)")
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(migrateCmd)
@@ -46,8 +57,7 @@ func initConfig() {
 		viper.SetConfigFile(cfgFile)
 		if !file.IsFile(cfgFile) {
 			// Config file not found; ignore error if desired
-			_, err := os.Create(cfgFile)
-			if err != nil {
+			if err := createConfigFile(); err != nil {
 				log.Fatal(err)
 			}
 		}
@@ -76,8 +86,7 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 			// Config file not found; ignore error if desired
-			_, err := os.Create(cfgFile)
-			if err != nil {
+			if err := createConfigFile(); err != nil {
 				log.Fatal(err)
 			}
 		} else {
@@ -85,6 +94,19 @@ func initConfig() {
 			slog.Error("read config error", "msg", err)
 		}
 	}
+
+	warnPlaintextSecrets()
+	profileErr = applyProfile()
+}
+
+// createConfigFile creates the empty config file only readable by the owner,
+// since it may contain tokens.
+func createConfigFile() error {
+	f, err := os.OpenFile(cfgFile, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
 }
 
 func Execute(ctx context.Context) error {
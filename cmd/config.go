@@ -1,7 +1,14 @@
 package cmd
 
 import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // configCmd represents the command for custom configuration,
@@ -9,3 +16,57 @@ var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "custom config (Bitbucket and Gitea server URL and Token)",
 }
+
+// newConfigFile creates an empty viper instance for the config file
+func newConfigFile() *viper.Viper {
+	v := viper.New()
+	v.SetConfigFile(cfgFile)
+	if filepath.Ext(cfgFile) == "" {
+		v.SetConfigType("yaml")
+	}
+	return v
+}
+
+// readConfigFile reads the config file only, without flags, environment
+// variables and the merged profile, so it can be written back as it is.
+func readConfigFile() (*viper.Viper, error) {
+	v := newConfigFile()
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// warnPlaintextSecrets warns when plaintext tokens or passwords
+// are found in a config file readable by other users.
+func warnPlaintextSecrets() {
+	info, err := os.Stat(cfgFile)
+	if err != nil || info.Mode().Perm()&0o004 == 0 {
+		return
+	}
+
+	v, err := readConfigFile()
+	if err != nil {
+		return
+	}
+
+	for _, key := range v.AllKeys() {
+		name := key[strings.LastIndex(key, ".")+1:]
+		if name != "token" && name != "password" && !strings.Contains(key, "access-tokens.") {
+			continue
+		}
+		if v.GetString(key) == "" {
+			continue
+		}
+		// access tokens have no file, env or command variants
+		hint := fmt.Sprintf("use %[1]s_file, %[1]s_env or %[1]s_command instead, or chmod 600 the file", name)
+		if strings.Contains(key, "access-tokens.") {
+			hint = "chmod 600 the file"
+		}
+		slog.Warn("plaintext secret found in world-readable config file, "+hint,
+			"key", key,
+			"file", cfgFile,
+		)
+	}
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+}
+
+// configGetCmd prints the effective config value, including
+// the selected profile and environment variables.
+var configGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "print the config value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := lookupKey(args[0]); err != nil {
+			return err
+		}
+
+		if !viper.IsSet(args[0]) {
+			return fmt.Errorf("config key %q is not set", args[0])
+		}
+
+		fmt.Println(viper.Get(args[0]))
+		return nil
+	},
+}
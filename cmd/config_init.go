@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/appleboy/BitbucketServer2Gitea/migration"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+func init() {
+	configCmd.AddCommand(configInitCmd)
+}
+
+// configInitCmd is an interactive wizard for the Bitbucket and Gitea settings.
+// The credentials are tested after each server is entered, and the settings
+// are written into the profile given by the --profile flag.
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "interactive wizard for the Bitbucket and Gitea config",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		w := &wizard{
+			reader: bufio.NewReader(os.Stdin),
+			values: map[string]string{},
+		}
+
+		w.section("Bitbucket", func() {
+			w.ask("bitbucket.server", "Bitbucket server URL")
+			w.ask("bitbucket.auth-type", "auth type (token or basic)")
+			w.ask("bitbucket.username", "username")
+			if w.values["bitbucket.auth-type"] == "basic" {
+				w.askSecret("bitbucket.password", "password")
+			} else {
+				w.askSecret("bitbucket.token", "HTTP access token")
+			}
+		}, func(ctx context.Context) []migration.Check {
+			return migration.CheckBitbucket(ctx, checkLogger(), nil)
+		})
+
+		w.section("Gitea", func() {
+			w.ask("gitea.server", "Gitea server URL")
+			w.askSecret("gitea.token", "access token")
+			w.ask("gitea.source-id", "auth source ID (0 for local accounts)")
+		}, func(ctx context.Context) []migration.Check {
+			return migration.CheckGitea(ctx, checkLogger())
+		})
+
+		for key, value := range w.values {
+			if value == "" {
+				continue
+			}
+			if err := setValue(v, key, []string{value}); err != nil {
+				return err
+			}
+		}
+
+		if err := v.WriteConfig(); err != nil {
+			return err
+		}
+
+		color.Green("you can see the config file: %s", cfgFile)
+		return nil
+	},
+}
+
+// wizard reads the config values from the terminal
+type wizard struct {
+	reader *bufio.Reader
+	values map[string]string
+}
+
+// section asks the values until the checks pass or the user skips the retry
+func (w *wizard) section(name string, ask func(), check func(ctx context.Context) []migration.Check) {
+	for {
+		color.Cyan("== %s ==", name)
+		ask()
+
+		// the entered values override the config for the checks
+		for key, value := range w.values {
+			viper.Set(key, value)
+		}
+
+		fmt.Println("testing the credentials ...")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		failed := printChecks(check(ctx))
+		cancel()
+
+		if failed == 0 || !w.confirm(fmt.Sprintf("%d checks failed, re-enter the %s settings?", failed, name)) {
+			return
+		}
+	}
+}
+
+// ask reads the value with the current value as default
+func (w *wizard) ask(key, label string) {
+	current := w.current(key)
+	if current != "" {
+		fmt.Printf("%s [%s]: ", label, current)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+
+	line, readErr := w.reader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = current
+	}
+
+	if k, err := lookupKey(key); err == nil && line != "" && readErr == nil {
+		if _, err := k.parseValue([]string{line}); err != nil {
+			color.Red("%v", err)
+			w.ask(key, label)
+			return
+		}
+	}
+	w.values[key] = line
+}
+
+// askSecret reads the secret without echo, keeping the current value if empty
+func (w *wizard) askSecret(key, label string) {
+	current := w.current(key)
+	if current != "" {
+		fmt.Printf("%s [%s]: ", label, maskSecret(current))
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+
+	var line string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		data, _ := term.ReadPassword(fd)
+		fmt.Println()
+		line = string(data)
+	} else {
+		line, _ = w.reader.ReadString('\n')
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = current
+	}
+	w.values[key] = line
+}
+
+func (w *wizard) confirm(question string) bool {
+	fmt.Printf("%s [Y/n]: ", question)
+	line, err := w.reader.ReadString('\n')
+	if err != nil {
+		// stop asking at the end of input
+		fmt.Println()
+		return false
+	}
+	line = strings.ToLower(strings.TrimSpace(line))
+	return line == "" || line == "y" || line == "yes"
+}
+
+// current get the entered value, or the value of the config
+func (w *wizard) current(key string) string {
+	if v, ok := w.values[key]; ok {
+		return v
+	}
+	return viper.GetString(key)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var listKnownKeys bool
+
+func init() {
+	configListCmd.Flags().BoolVar(&listKnownKeys, "known", false, "list all known config keys with the types")
+	configCmd.AddCommand(configListCmd)
+}
+
+// configListCmd prints the effective config values with masked secrets.
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the config values",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if listKnownKeys {
+			for _, key := range knownKeys() {
+				fmt.Printf("%s (%s)\n", key, configSchema[key].Type)
+			}
+			return nil
+		}
+
+		if activeProfile != "" {
+			fmt.Printf("# profile: %s\n", activeProfile)
+		}
+
+		keys := viper.AllKeys()
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := fmt.Sprint(viper.Get(key))
+			if isSecretKey(key) {
+				value = maskSecret(value)
+			}
+			fmt.Printf("%s = %s\n", key, value)
+		}
+
+		return nil
+	},
+}
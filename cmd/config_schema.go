@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valueType config value type
+type valueType string
+
+const (
+	typeString   valueType = "string"
+	typeBool     valueType = "bool"
+	typeInt      valueType = "int"
+	typeFloat    valueType = "float"
+	typeDuration valueType = "duration"
+	typeList     valueType = "list"
+)
+
+// configKey known config key
+type configKey struct {
+	Type   valueType
+	Secret bool
+	// Enum allowed values
+	Enum []string
+}
+
+// serverKeys keys shared by the bitbucket and gitea config blocks
+var serverKeys = map[string]configKey{
+	"server":           {Type: typeString},
+	"token":            {Type: typeString, Secret: true},
+	"token_file":       {Type: typeString},
+	"token_env":        {Type: typeString},
+	"token_command":    {Type: typeString},
+	"rate-limit.rps":   {Type: typeFloat},
+	"rate-limit.burst": {Type: typeInt},
+}
+
+// tlsKeys keys of the config blocks with a http client
+var tlsKeys = map[string]configKey{
+	"skip-verify":     {Type: typeBool},
+	"tls.ca-file":     {Type: typeString},
+	"tls.cert-file":   {Type: typeString},
+	"tls.key-file":    {Type: typeString},
+	"tls.min-version": {Type: typeString, Enum: []string{"1.0", "1.1", "1.2", "1.3"}},
+	"tls.server-name": {Type: typeString},
+}
+
+// configSchema all known config keys
+var configSchema = func() map[string]configKey {
+	schema := map[string]configKey{
+		"profile":                          {Type: typeString},
+		"timeout":                          {Type: typeDuration},
+		"repo-timeout":                     {Type: typeDuration},
+		"poll-interval":                    {Type: typeDuration},
+		"build-status.enabled":             {Type: typeBool},
+		"build-status.depth":               {Type: typeInt},
+		"merge-checks.enabled":             {Type: typeBool},
+		"audit.max-file-size":              {Type: typeInt},
+		"audit.max-repo-size":              {Type: typeInt},
+		"audit.max-commits":                {Type: typeInt},
+		"audit.block-on":                   {Type: typeString, Enum: []string{"medium", "high"}},
+		"audit.report":                     {Type: typeString},
+		"progress":                         {Type: typeBool},
+		"metrics.addr":                     {Type: typeString},
+		"notify.webhooks.*.url":            {Type: typeString, Secret: true},
+		"notify.webhooks.*.url_file":       {Type: typeString},
+		"notify.webhooks.*.url_env":        {Type: typeString},
+		"notify.webhooks.*.url_command":    {Type: typeString},
+		"notify.webhooks.*.type":           {Type: typeString, Enum: []string{"json", "slack", "mattermost", "teams"}},
+		"notify.webhooks.*.events":         {Type: typeList},
+		"notify.webhooks.*.template":       {Type: typeString},
+		"notify.templates.*":               {Type: typeString},
+		"jira.enabled":                     {Type: typeBool},
+		"jira.url":                         {Type: typeString},
+		"jira.projects.*":                  {Type: typeString},
+		"topics.mapping.*":                 {Type: typeString},
+		"release.pattern":                  {Type: typeString},
+		"release.changelog":                {Type: typeBool},
+		"archived.skip":                    {Type: typeBool},
+		"archived.org":                     {Type: typeString},
+		"on-conflict":                      {Type: typeString, Enum: []string{"skip", "fail", "rename", "update", "recreate"}},
+		"naming.owner":                     {Type: typeString},
+		"naming.repo":                      {Type: typeString},
+		"naming.replacement":               {Type: typeString, Enum: []string{"-", "_", ".", ""}},
+		"http.timeout":                     {Type: typeDuration},
+		"http.retry.max":                   {Type: typeInt},
+		"http.retry.wait-min":              {Type: typeDuration},
+		"http.retry.wait-max":              {Type: typeDuration},
+		"http.proxy":                       {Type: typeString},
+		"http.no-proxy":                    {Type: typeString},
+		"bitbucket.username":               {Type: typeString},
+		"bitbucket.password":               {Type: typeString, Secret: true},
+		"bitbucket.password_file":          {Type: typeString},
+		"bitbucket.password_env":           {Type: typeString},
+		"bitbucket.password_command":       {Type: typeString},
+		"bitbucket.auth-type":              {Type: typeString, Enum: []string{"token", "basic"}},
+		"bitbucket.ssh-key":                {Type: typeString},
+		"bitbucket.clone.auth-type":        {Type: typeString, Enum: []string{"token", "basic"}},
+		"bitbucket.clone.username":         {Type: typeString},
+		"bitbucket.clone.password":         {Type: typeString, Secret: true},
+		"bitbucket.clone.password_file":    {Type: typeString},
+		"bitbucket.clone.password_env":     {Type: typeString},
+		"bitbucket.clone.password_command": {Type: typeString},
+		"bitbucket.clone.token":            {Type: typeString, Secret: true},
+		"bitbucket.clone.token_file":       {Type: typeString},
+		"bitbucket.clone.token_env":        {Type: typeString},
+		"bitbucket.clone.token_command":    {Type: typeString},
+		"bitbucket.access-tokens.*":        {Type: typeString, Secret: true},
+		"gitea.source-id":                  {Type: typeInt},
+	}
+	for _, server := range []string{"bitbucket", "gitea"} {
+		for k, v := range serverKeys {
+			schema[server+"."+k] = v
+		}
+	}
+	for _, client := range []string{"bitbucket", "gitea", "notify"} {
+		for k, v := range tlsKeys {
+			schema[client+"."+k] = v
+		}
+	}
+	return schema
+}()
+
+// lookupKey find the schema of the key, keys inside a profile are
+// looked up without the profiles.<name> prefix.
+func lookupKey(key string) (configKey, error) {
+	key = strings.ToLower(key)
+	if strings.HasPrefix(key, "profiles.") {
+		parts := strings.SplitN(key, ".", 3)
+		if len(parts) < 3 {
+			return configKey{}, fmt.Errorf("config key %q must be profiles.<name>.<key>", key)
+		}
+		key = parts[2]
+	}
+
+	if k, ok := configSchema[key]; ok {
+		return k, nil
+	}
+
+	// wildcard keys like bitbucket.access-tokens.<project>
+	for pattern, k := range configSchema {
+		if strings.Contains(pattern, "*") && matchWildcard(pattern, key) {
+			return k, nil
+		}
+	}
+
+	if suggestion := suggestKey(key); suggestion != "" {
+		return configKey{}, fmt.Errorf("unknown config key %q, did you mean %q?", key, suggestion)
+	}
+	return configKey{}, fmt.Errorf("unknown config key %q, see config list for the known keys", key)
+}
+
+// matchWildcard check the key matches the pattern, each * matches a single
+// non-empty segment of the key.
+func matchWildcard(pattern, key string) bool {
+	patterns := strings.Split(pattern, ".")
+	segments := strings.Split(key, ".")
+	if len(patterns) != len(segments) {
+		return false
+	}
+	for i, p := range patterns {
+		if segments[i] == "" || (p != "*" && p != segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseValue convert the arguments to the typed value of the key
+func (k configKey) parseValue(args []string) (interface{}, error) {
+	if k.Type == typeList {
+		values := []string{}
+		for _, arg := range args {
+			for _, v := range strings.Split(arg, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		return values, nil
+	}
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected a single %s value", k.Type)
+	}
+	value := args[0]
+
+	if len(k.Enum) > 0 {
+		found := false
+		for _, e := range k.Enum {
+			if value == e {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("value %q invalid, must be one of %s", value, strings.Join(k.Enum, ", "))
+		}
+	}
+
+	switch k.Type {
+	case typeBool:
+		return strconv.ParseBool(value)
+	case typeInt:
+		return strconv.Atoi(value)
+	case typeFloat:
+		return strconv.ParseFloat(value, 64)
+	case typeDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// suggestKey find the closest known key for typos
+func suggestKey(key string) string {
+	best, bestDistance := "", 4
+	for _, known := range knownKeys() {
+		if d := levenshtein(key, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// knownKeys get the sorted known keys
+func knownKeys() []string {
+	keys := make([]string, 0, len(configSchema))
+	for k := range configSchema {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// isSecretKey check the key holds a secret value
+func isSecretKey(key string) bool {
+	k, err := lookupKey(key)
+	return err == nil && k.Secret
+}
+
+// maskSecret mask the secret value
+func maskSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "********"
+}
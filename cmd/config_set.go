@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -11,38 +15,78 @@ func init() {
 	configSetCmd.Flags().StringP("bitbucket-token", "", "", "access token for Bitbucket API access")
 	configSetCmd.Flags().StringP("bitbucket-server", "", "", "Bitbucket server URL with a trailing slash (https://stash.example.com/rest/)")
 	configSetCmd.Flags().StringP("bitbucket-username", "", "", "username for Bitbucket API access")
+	configSetCmd.Flags().StringP("bitbucket-password", "", "", "password for Bitbucket basic auth")
+	configSetCmd.Flags().StringP("bitbucket-auth-type", "", "token", "auth type for Bitbucket API access (token or basic)")
 	configSetCmd.Flags().StringP("gitea-token", "", "", "token for Gitea API access")
 	configSetCmd.Flags().StringP("gitea-server", "", "", "Gitea server URL (https://gitea.example.com/)")
-	configSetCmd.Flags().BoolP("gitea-skip-verify", "", true, "Skip SSL verification for Gitea server")
+	configSetCmd.Flags().BoolP("bitbucket-skip-verify", "", false, "Skip SSL verification for Bitbucket server")
+	configSetCmd.Flags().BoolP("gitea-skip-verify", "", false, "Skip SSL verification for Gitea server")
 	configSetCmd.Flags().Int64P("gitea-source-id", "", 0, "gitea target repo")
 	_ = viper.BindPFlag("bitbucket.token", configSetCmd.Flags().Lookup("bitbucket-token"))
 	_ = viper.BindPFlag("bitbucket.server", configSetCmd.Flags().Lookup("bitbucket-server"))
 	_ = viper.BindPFlag("bitbucket.username", configSetCmd.Flags().Lookup("bitbucket-username"))
+	_ = viper.BindPFlag("bitbucket.password", configSetCmd.Flags().Lookup("bitbucket-password"))
+	_ = viper.BindPFlag("bitbucket.auth-type", configSetCmd.Flags().Lookup("bitbucket-auth-type"))
 	_ = viper.BindPFlag("gitea.token", configSetCmd.Flags().Lookup("gitea-token"))
 	_ = viper.BindPFlag("gitea.server", configSetCmd.Flags().Lookup("gitea-server"))
+	_ = viper.BindPFlag("bitbucket.skip-verify", configSetCmd.Flags().Lookup("bitbucket-skip-verify"))
 	_ = viper.BindPFlag("gitea.skip-verify", configSetCmd.Flags().Lookup("gitea-skip-verify"))
 	_ = viper.BindPFlag("gitea.source-id", configSetCmd.Flags().Lookup("gitea-source-id"))
 }
 
 // configSetCmd updates the config value.
-// It takes at least two arguments, the first one being the key and the second one being the value.
-// If the key is not available, it returns an error message.
-// If the key is "git.exclude_list", it sets the value as a slice of strings.
+// It takes at least two arguments, the first one being the key and the rest being the value.
+// The key is validated against the known keys, and the value is converted to the key type,
+// list values can be given as multiple arguments or comma separated.
+// The value is written into the profile given by the --profile flag.
 // It writes the config to file and prints a success message with the config file location.
 var configSetCmd = &cobra.Command{
 	Use:   "set",
 	Short: "update the config value",
 	Args:  cobra.MinimumNArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		viper.Set(args[0], args[1])
+		v, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		if err := setValue(v, args[0], args[1:]); err != nil {
+			return err
+		}
+		// flags like --bitbucket-token map to the bitbucket.token key
+		var flagErr error
+		cmd.LocalNonPersistentFlags().Visit(func(f *pflag.Flag) {
+			if err := setValue(v, strings.Replace(f.Name, "-", ".", 1), []string{f.Value.String()}); err != nil {
+				flagErr = err
+			}
+		})
+		if flagErr != nil {
+			return flagErr
+		}
 
 		// Write config to file
-		if err := viper.WriteConfig(); err != nil {
+		if err := v.WriteConfig(); err != nil {
 			return err
 		}
 
 		// Print success message with config file location
-		color.Green("you can see the config file: %s", viper.ConfigFileUsed())
+		color.Green("you can see the config file: %s", cfgFile)
 		return nil
 	},
 }
+
+// setValue validates the key and sets the typed value into the profile
+func setValue(v *viper.Viper, key string, args []string) error {
+	k, err := lookupKey(key)
+	if err != nil {
+		return err
+	}
+
+	value, err := k.parseValue(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	v.Set(profileKey(key), value)
+	return nil
+}
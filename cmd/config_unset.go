@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	configCmd.AddCommand(configUnsetCmd)
+}
+
+// configUnsetCmd removes the key from the config file,
+// or from the profile given by the --profile flag.
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset",
+	Short: "remove the config value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(profileKey(args[0]))
+		settings := v.AllSettings()
+		if !deleteKey(settings, strings.Split(key, ".")) {
+			return fmt.Errorf("config key %q is not set in %s", key, cfgFile)
+		}
+
+		// viper can't remove a key, so write the remaining settings
+		// into a new instance.
+		n := newConfigFile()
+		if err := n.MergeConfigMap(settings); err != nil {
+			return err
+		}
+		if err := n.WriteConfig(); err != nil {
+			return err
+		}
+
+		color.Green("removed %s from %s", key, cfgFile)
+		return nil
+	},
+}
+
+// deleteKey deletes the nested key and the empty parents
+func deleteKey(m map[string]interface{}, path []string) bool {
+	if len(path) == 1 {
+		if _, ok := m[path[0]]; !ok {
+			return false
+		}
+		delete(m, path[0])
+		return true
+	}
+
+	child, ok := m[path[0]].(map[string]interface{})
+	if !ok || !deleteKey(child, path[1:]) {
+		return false
+	}
+	if len(child) == 0 {
+		delete(m, path[0])
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	configCmd.AddCommand(configUseProfileCmd)
+}
+
+// configUseProfileCmd sets the default profile used by all commands.
+// The profile must exist in the config file.
+var configUseProfileCmd = &cobra.Command{
+	Use:   "use-profile",
+	Short: "set the default profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.ToLower(args[0])
+
+		v, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		if !v.IsSet("profiles." + name) {
+			return fmt.Errorf("profile %q not found in %s", name, cfgFile)
+		}
+
+		v.Set("profile", name)
+		if err := v.WriteConfig(); err != nil {
+			return err
+		}
+
+		color.Green("switched to profile %s", name)
+		return nil
+	},
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/appleboy/BitbucketServer2Gitea/migration"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var doctorProjectKeys []string
+
+func init() {
+	doctorCmd.Flags().StringSliceVar(&doctorProjectKeys, "project-key", nil, "project keys to check the project admin permission")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorCmd validates the connectivity and privileges of both servers
+// and prints a pass/fail checklist.
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "check the connectivity and privileges of Bitbucket and Gitea",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		logger := checkLogger()
+		failed := printChecks(migration.Doctor(ctx, logger, migration.DoctorOption{
+			ProjectKeys: doctorProjectKeys,
+		}))
+		if failed > 0 {
+			return fmt.Errorf("%d checks failed", failed)
+		}
+
+		return nil
+	},
+}
+
+// printChecks prints the checklist and returns the number of failed checks
+func printChecks(checks []migration.Check) int {
+	failed := 0
+	for _, check := range checks {
+		switch check.Status {
+		case migration.CheckPass:
+			color.Green("[PASS] %s: %s", check.Name, check.Message)
+		case migration.CheckWarn:
+			color.Yellow("[WARN] %s: %s", check.Name, check.Message)
+		default:
+			failed++
+			color.Red("[FAIL] %s: %s", check.Name, check.Message)
+		}
+	}
+	return failed
+}
+
+// checkLogger creates the logger for checks, only warnings are printed
+// unless debug mode is enabled.
+func checkLogger() *slog.Logger {
+	logLevel := slog.LevelWarn
+	if debug {
+		logLevel = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+}
@@ -1,21 +1,34 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/appleboy/BitbucketServer2Gitea/migration"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	projectKey  string
-	repoSlug    string
-	targetOwner string
-	targetRepo  string
+	projectKey   string
+	repoSlug     string
+	targetOwner  string
+	targetRepo   string
+	transfer     string
+	workspace    string
+	protocol     string
+	lfs          bool
+	lfsEndpoint  string
+	lfsFallback  bool
+	manifestFile string
+	assumeYes    bool
 )
 
 func init() {
@@ -23,8 +36,52 @@ func init() {
 	migrateCmd.PersistentFlags().StringVar(&repoSlug, "repo-slug", "", "the repository slug")
 	migrateCmd.PersistentFlags().StringVar(&targetOwner, "target-owner", "", "gitea target owner")
 	migrateCmd.PersistentFlags().StringVar(&targetRepo, "target-repo", "", "gitea target repo")
-	migrateCmd.Flags().StringP("timeout", "t", "10m", "timeout for migration")
+	migrateCmd.PersistentFlags().StringVar(&manifestFile, "manifest", "", "yaml or csv manifest file listing the repositories to migrate")
+	migrateCmd.PersistentFlags().StringVar(&transfer, "transfer", string(migration.TransferPull), "transfer mode, pull (gitea pulls from bitbucket) or push (clone locally and push to gitea)")
+	migrateCmd.PersistentFlags().StringVar(&workspace, "workspace", "", "workspace folder for push transfer mode (default is system temp folder)")
+	migrateCmd.PersistentFlags().StringVar(&protocol, "clone-protocol", "http", "bitbucket clone link protocol, http or ssh (ssh requires push transfer mode)")
+	migrateCmd.PersistentFlags().BoolVar(&lfs, "lfs", false, "migrate git lfs objects (requires git-lfs for uploading the objects)")
+	migrateCmd.PersistentFlags().StringVar(&lfsEndpoint, "lfs-endpoint", "", "override the bitbucket lfs endpoint")
+	migrateCmd.PersistentFlags().BoolVar(&lfsFallback, "lfs-fallback", false, "upload lfs objects missing in gitea after the pull migration")
+	migrateCmd.Flags().StringP("timeout", "t", "10m", "timeout for the run, repositories waiting to start are skipped after it")
+	migrateCmd.Flags().String("repo-timeout", "0", "timeout for each repository migration, independent of the run timeout (0 means no timeout)")
+	migrateCmd.Flags().String("poll-interval", "10s", "interval for polling the gitea migration status")
+	migrateCmd.Flags().String("owner-template", "", "gitea organization name template, e.g. {{ .ProjectKey | lower }} (default is the project name)")
+	migrateCmd.Flags().String("repo-template", "", "gitea repository name template, e.g. legacy-{{ .RepoSlug }} (default is the repository name)")
+	migrateCmd.Flags().String("name-replacement", "-", "replacement for characters not allowed in gitea names, one of - _ . or empty")
+	migrateCmd.Flags().String("on-conflict", string(migration.ConflictSkip), "action when the target repository exists: skip, fail, rename, update or recreate")
+	migrateCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "don't ask for confirmation before deleting existing repositories")
+	migrateCmd.Flags().Bool("skip-archived", false, "don't migrate archived bitbucket repositories")
+	migrateCmd.Flags().String("archive-org", "", "migrate archived bitbucket repositories into this gitea organization")
+	migrateCmd.Flags().String("release-pattern", "", "create gitea releases from the tags matching the glob pattern, e.g. v*")
+	migrateCmd.Flags().Bool("release-changelog", false, "add the commit subjects since the previous release tag to the release notes")
+	migrateCmd.Flags().Bool("jira", false, "use jira as the external issue tracker of the repositories")
+	migrateCmd.Flags().String("jira-url", "", "jira base URL (default is detected from the bitbucket application links)")
+	migrateCmd.Flags().Bool("build-status", false, "migrate the build statuses and code insights results as gitea commit statuses")
+	migrateCmd.Flags().Int("build-status-depth", 20, "number of recent commits of the default branch for build statuses, besides the branch heads")
+	migrateCmd.Flags().Bool("merge-checks", false, "translate the merge checks into gitea branch protection of all branches")
+	migrateCmd.Flags().String("audit-report", "", "json report of the audit command, repositories blocked by the audit aren't migrated")
+	migrateCmd.Flags().Bool("progress", true, "show the progress view when stdout is a terminal")
+	migrateCmd.Flags().String("metrics-addr", "", "serve prometheus metrics on the address during the run, e.g. :9090")
+	_ = viper.BindPFlag("progress", migrateCmd.Flags().Lookup("progress"))
+	_ = viper.BindPFlag("metrics.addr", migrateCmd.Flags().Lookup("metrics-addr"))
+	_ = viper.BindPFlag("audit.report", migrateCmd.Flags().Lookup("audit-report"))
+	_ = viper.BindPFlag("merge-checks.enabled", migrateCmd.Flags().Lookup("merge-checks"))
+	_ = viper.BindPFlag("build-status.enabled", migrateCmd.Flags().Lookup("build-status"))
+	_ = viper.BindPFlag("build-status.depth", migrateCmd.Flags().Lookup("build-status-depth"))
+	_ = viper.BindPFlag("jira.enabled", migrateCmd.Flags().Lookup("jira"))
+	_ = viper.BindPFlag("jira.url", migrateCmd.Flags().Lookup("jira-url"))
+	_ = viper.BindPFlag("release.pattern", migrateCmd.Flags().Lookup("release-pattern"))
+	_ = viper.BindPFlag("release.changelog", migrateCmd.Flags().Lookup("release-changelog"))
+	_ = viper.BindPFlag("archived.skip", migrateCmd.Flags().Lookup("skip-archived"))
+	_ = viper.BindPFlag("archived.org", migrateCmd.Flags().Lookup("archive-org"))
+	_ = viper.BindPFlag("on-conflict", migrateCmd.Flags().Lookup("on-conflict"))
+	_ = viper.BindPFlag("naming.owner", migrateCmd.Flags().Lookup("owner-template"))
+	_ = viper.BindPFlag("naming.repo", migrateCmd.Flags().Lookup("repo-template"))
+	_ = viper.BindPFlag("naming.replacement", migrateCmd.Flags().Lookup("name-replacement"))
 	_ = viper.BindPFlag("timeout", migrateCmd.Flags().Lookup("timeout"))
+	_ = viper.BindPFlag("repo-timeout", migrateCmd.Flags().Lookup("repo-timeout"))
+	_ = viper.BindPFlag("poll-interval", migrateCmd.Flags().Lookup("poll-interval"))
 }
 
 var migrateCmd = &cobra.Command{
@@ -36,6 +93,41 @@ var migrateCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		repoTimeout, err := time.ParseDuration(viper.GetString("repo-timeout"))
+		if err != nil {
+			return err
+		}
+		pollInterval, err := time.ParseDuration(viper.GetString("poll-interval"))
+		if err != nil {
+			return err
+		}
+
+		mode := migration.TransferMode(transfer)
+		if mode != migration.TransferPull && mode != migration.TransferPush {
+			return fmt.Errorf("transfer mode %q invalid", transfer)
+		}
+		onConflict, err := migration.ParseConflictPolicy(viper.GetString("on-conflict"))
+		if err != nil {
+			return err
+		}
+		if protocol != "http" && protocol != "ssh" {
+			return fmt.Errorf("clone protocol %q invalid", protocol)
+		}
+		if protocol == "ssh" && mode != migration.TransferPush {
+			return errors.New("ssh clone protocol requires push transfer mode")
+		}
+
+		manifest, err := loadManifest(cmd)
+		if err != nil {
+			return err
+		}
+		var auditReports map[string]migration.AuditReport
+		if file := viper.GetString("audit.report"); file != "" {
+			auditReports, err = migration.LoadAuditReports(file)
+			if err != nil {
+				return err
+			}
+		}
 
 		// command timeout
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -43,87 +135,132 @@ var migrateCmd = &cobra.Command{
 		m, err := migration.NewMigration(
 			ctx,
 			migration.Option{
-				Debug: debug,
+				Debug:         debug,
+				Transfer:      mode,
+				Workspace:     workspace,
+				CloneProtocol: protocol,
+				Naming: migration.NamingOption{
+					Owner:       viper.GetString("naming.owner"),
+					Repo:        viper.GetString("naming.repo"),
+					Replacement: viper.GetString("naming.replacement"),
+				},
+				LFS: migration.LFSOption{
+					Enabled:  lfs,
+					Endpoint: lfsEndpoint,
+					Fallback: lfsFallback,
+				},
+				OnConflict: onConflict,
+				Topics:     viper.GetStringMapString("topics.mapping"),
+				BuildStatus: migration.BuildStatusOption{
+					Enabled: viper.GetBool("build-status.enabled"),
+					Depth:   viper.GetInt("build-status.depth"),
+				},
+				Jira: migration.JiraOption{
+					Enabled:  viper.GetBool("jira.enabled"),
+					URL:      viper.GetString("jira.url"),
+					Projects: viper.GetStringMapString("jira.projects"),
+				},
+				MergeChecks:  viper.GetBool("merge-checks.enabled"),
+				AuditReports: auditReports,
+				Progress:     viper.GetBool("progress"),
+				Release: migration.ReleaseOption{
+					Pattern:   viper.GetString("release.pattern"),
+					Changelog: viper.GetBool("release.changelog"),
+				},
+				Archived: migration.ArchivedOption{
+					Skip: viper.GetBool("archived.skip"),
+					Org:  viper.GetString("archived.org"),
+				},
+				RepoTimeout:  repoTimeout,
+				PollInterval: pollInterval,
 			})
 		if err != nil {
 			return err
 		}
+		defer func() {
+			for server, stats := range m.RateLimitStats() {
+				m.Logger.Info("rate limit wait",
+					"server", server,
+					"waits", stats.Waits,
+					"wait_time", stats.WaitTime,
+				)
+			}
+		}()
 
-		repoList := []string{}
-
-		if projectKey == "" {
-			return errors.New("project-key can't be empty")
+		if addr := viper.GetString("metrics.addr"); addr != "" {
+			// the running repository outlives the run timeout, so the
+			// server is stopped when the migration returns instead
+			metricsCtx, stopMetrics := context.WithCancel(context.Background())
+			defer stopMetrics()
+			if err := migration.ServeMetrics(metricsCtx, m.Logger, addr); err != nil {
+				return err
+			}
 		}
 
-		orgResp, err := m.GetProjectData(projectKey)
+		// validate the whole manifest before migrating
+		entries, err := m.Plan(manifest)
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid manifest:\n%w", err)
 		}
 
-		if repoSlug != "" {
-			repoList = append(repoList, repoSlug)
-		} else {
-			// get all repository list
-			repos, err := m.Bitbucket.GetRepositories(projectKey)
+		if onConflict == migration.ConflictRecreate {
+			existing, err := m.ExistingTargets(entries)
 			if err != nil {
 				return err
 			}
-
-			for _, repo := range repos {
-				repoList = append(repoList, repo.Slug)
+			if len(existing) > 0 && !confirmRecreate(existing) {
+				return errors.New("migration canceled")
 			}
 		}
 
-		// check gitea owner exist
-		if targetOwner == "" {
-			targetOwner = orgResp.Project.Name
-		}
+		return m.Migrate(entries)
+	},
+}
 
-		// create new gitea organization
-		err = m.CreateNewOrg(migration.CreateNewOrgOption{
-			Name:        targetOwner,
-			Description: orgResp.Project.Description,
-			Public:      orgResp.Project.Public,
-			Permission:  orgResp.Permission,
-		})
-		if err != nil {
-			return err
-		}
+// confirmRecreate ask before deleting the existing repositories
+func confirmRecreate(existing []migration.ManifestEntry) bool {
+	if assumeYes {
+		return true
+	}
 
-		for _, repoSlug := range repoList {
-			repoResp, err := m.GetRepositoryData(projectKey, repoSlug)
-			if err != nil {
-				return err
-			}
-
-			repoName := repoResp.Repository.Name
-			// check gitea repository exist
-			if targetRepo != "" && len(repoList) == 1 {
-				repoName = targetRepo
-			}
+	color.Yellow("the following %d repositories exist and will be deleted:", len(existing))
+	for _, e := range existing {
+		fmt.Println("  " + e.Target())
+	}
+	fmt.Print("delete and recreate them? [y/N]: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		return false
+	}
+	line = strings.ToLower(strings.TrimSpace(line))
+	return line == "y" || line == "yes"
+}
 
-			cloneAddr := ""
-			for _, link := range repoResp.Repository.Links.Clone {
-				if link.Name == "http" {
-					cloneAddr = link.Href
-					break
-				}
-			}
+// loadManifest read the manifest file, or build a single entry manifest
+// from the --project-key, --repo-slug, --target-owner and --target-repo flags.
+func loadManifest(cmd *cobra.Command) (*migration.Manifest, error) {
+	if manifestFile == "" {
+		if projectKey == "" {
+			return nil, errors.New("project-key or manifest can't be empty")
+		}
+		return &migration.Manifest{
+			Repositories: []migration.ManifestEntry{
+				{
+					ProjectKey:  projectKey,
+					RepoSlug:    repoSlug,
+					TargetOwner: targetOwner,
+					TargetName:  targetRepo,
+				},
+			},
+		}, nil
+	}
 
-			// create new gitea repository
-			err = m.MigrateNewRepo(migration.MigrateNewRepoOption{
-				Owner:       targetOwner,
-				Name:        repoName,
-				CloneAddr:   cloneAddr,
-				Description: repoResp.Repository.Description,
-				Private:     !repoResp.Repository.Public,
-				Permission:  repoResp.Permission,
-			})
-			if err != nil {
-				m.Logger.Error("migration repository error", "error", err)
-			}
+	for _, name := range []string{"project-key", "repo-slug", "target-owner", "target-repo"} {
+		if cmd.Flags().Changed(name) {
+			return nil, fmt.Errorf("%s can't be used with manifest", name)
 		}
+	}
 
-		return nil
-	},
+	return migration.LoadManifest(manifestFile)
 }
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// applyProfile merge the selected profile into the config.
+// The profile is selected by the --profile flag, or the profile key
+// in the config file which is set by the use-profile command.
+// Environment variables prefixed with the profile name, like
+// PROD_BITBUCKET_TOKEN, override the values of the profile.
+func applyProfile() error {
+	name := strings.ToLower(profile)
+	if name == "" {
+		name = strings.ToLower(viper.GetString("profile"))
+	}
+	if name == "" {
+		return nil
+	}
+
+	key := "profiles." + name
+	if !viper.IsSet(key) {
+		return fmt.Errorf("profile %q not found in %s", name, cfgFile)
+	}
+
+	if err := viper.MergeConfigMap(viper.GetStringMap(key)); err != nil {
+		return err
+	}
+
+	// the schema keys can be set by the environment even if they aren't
+	// in the config, the wildcard keys only when the config names them
+	keys := map[string]bool{}
+	for _, k := range knownKeys() {
+		if !strings.Contains(k, "*") {
+			keys[k] = true
+		}
+	}
+	for _, k := range viper.AllKeys() {
+		keys[k] = true
+	}
+
+	prefix := strings.ToUpper(replacer.Replace(name)) + "_"
+	for k := range keys {
+		if k == "profile" || strings.HasPrefix(k, "profiles.") {
+			continue
+		}
+		if v, ok := os.LookupEnv(prefix + strings.ToUpper(replacer.Replace(k))); ok {
+			viper.Set(k, v)
+		}
+	}
+
+	activeProfile = name
+	return nil
+}
+
+// profileKey get the config key inside the profile given by --profile flag
+func profileKey(key string) string {
+	if profile == "" {
+		return key
+	}
+
+	return "profiles." + strings.ToLower(profile) + "." + key
+}
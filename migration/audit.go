@@ -0,0 +1,588 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Risk audit risk level of the repository
+type Risk string
+
+const (
+	// RiskNone no findings
+	RiskNone Risk = ""
+	// RiskMedium the migration works, but the repository should be cleaned up
+	RiskMedium Risk = "medium"
+	// RiskHigh the migration can fail or leak secrets into gitea
+	RiskHigh Risk = "high"
+)
+
+// ParseRisk check the risk level name
+func ParseRisk(name string) (Risk, error) {
+	switch Risk(name) {
+	case RiskMedium, RiskHigh:
+		return Risk(name), nil
+	}
+	return "", fmt.Errorf("risk %q invalid, must be %s or %s", name, RiskMedium, RiskHigh)
+}
+
+func (r Risk) rank() int {
+	switch r {
+	case RiskMedium:
+		return 1
+	case RiskHigh:
+		return 2
+	}
+	return 0
+}
+
+// errBlocked the migration was blocked by the audit report
+var errBlocked = errors.New("migration blocked by audit")
+
+// audit checks
+const (
+	checkLargeFile   = "large-file"
+	checkLFSPointer  = "lfs-pointer"
+	checkHistorySize = "history-size"
+	checkCommits     = "history-commits"
+	checkSecret      = "secret"
+)
+
+const (
+	// maxFindings limit of the reported findings per check
+	maxFindings = 50
+	// secretScanMaxSize blobs larger than this size aren't scanned for secrets
+	secretScanMaxSize = 1 << 20
+	// lfsPointerMaxSize git lfs pointer files are smaller than this size
+	lfsPointerMaxSize = 1024
+	lfsPointerPrefix  = "version https://git-lfs.github.com/spec/v1"
+)
+
+// AuditOption thresholds of the repository audit
+type AuditOption struct {
+	// MaxFileSize largest file size in bytes allowed in the history
+	MaxFileSize int64
+	// MaxRepoSize largest packed repository size in bytes
+	MaxRepoSize int64
+	// MaxCommits largest number of commits
+	MaxCommits int
+	// BlockOn repositories with this risk or higher are blocked
+	BlockOn Risk
+}
+
+// Finding single audit finding
+type Finding struct {
+	Check   string `json:"check"`
+	Risk    Risk   `json:"risk"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// AuditReport audit result of the repository
+type AuditReport struct {
+	// Source the bitbucket project/repo
+	Source string `json:"source"`
+	// Size packed size of the repository in bytes
+	Size     int64     `json:"size"`
+	Commits  int       `json:"commits"`
+	Risk     Risk      `json:"risk"`
+	Blocked  bool      `json:"blocked"`
+	Findings []Finding `json:"findings,omitempty"`
+	// Omitted number of findings over the limit per check
+	Omitted int    `json:"omitted,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	counts map[string]int
+}
+
+func (r *AuditReport) add(f Finding) {
+	if f.Risk.rank() > r.Risk.rank() {
+		r.Risk = f.Risk
+	}
+	if r.counts == nil {
+		r.counts = map[string]int{}
+	}
+	r.counts[f.Check]++
+	if r.counts[f.Check] > maxFindings {
+		r.Omitted++
+		return
+	}
+	r.Findings = append(r.Findings, f)
+}
+
+// secretRule pattern of a committed secret
+type secretRule struct {
+	Name    string
+	Risk    Risk
+	Pattern *regexp.Regexp
+}
+
+var secretRules = []secretRule{
+	{"private key", RiskHigh, regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`)},
+	{"aws access key", RiskHigh, regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github token", RiskHigh, regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"gitlab token", RiskHigh, regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{"slack token", RiskHigh, regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"google api key", RiskHigh, regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"password assignment", RiskMedium, regexp.MustCompile(`(?i)(password|passwd|pwd|secret|api[_-]?key|access[_-]?token)["']?\s*[:=]\s*["'][^"'\s]{8,}["']`)},
+}
+
+// blob git blob of the repository history
+type blob struct {
+	Oid  string
+	Size int64
+	Path string
+}
+
+// Audit clone every repository of the plan into the workspace and scan it
+// for large files, files missing their lfs pointer, huge histories and
+// committed secrets. Repositories failing the audit get a blocked report
+// with the error instead of stopping the audit.
+func (m *migration) Audit(entries []ManifestEntry, opts AuditOption) []AuditReport {
+	if opts.BlockOn == RiskNone {
+		opts.BlockOn = RiskHigh
+	}
+
+	reports := []AuditReport{}
+	for _, e := range entries {
+		report, err := m.auditRepo(e, opts)
+		if err != nil {
+			m.Logger.Error("audit repository error", "source", e.Source(), "error", err)
+			report.Error = err.Error()
+		}
+		// a repository that couldn't be scanned isn't known to be safe
+		report.Blocked = err != nil || report.Risk.rank() >= opts.BlockOn.rank()
+		reports = append(reports, report)
+	}
+
+	return reports
+}
+
+func (m *migration) auditRepo(e ManifestEntry, opts AuditOption) (AuditReport, error) {
+	report := AuditReport{Source: e.Source()}
+	logger := m.Logger.With("source", e.Source())
+
+	repo, err := m.Bitbucket.GetRepo(e.ProjectKey, e.RepoSlug)
+	if err != nil {
+		return report, err
+	}
+	cloneAddr, err := m.cloneLink(repo)
+	if err != nil {
+		return report, err
+	}
+	remote := m.Bitbucket.CloneRemote(e.ProjectKey, e.RepoSlug, cloneAddr)
+
+	logger.Info("start audit repository")
+	dir, err := cloneMirror(m.ctx, logger, m.workspace, remote)
+	if err != nil {
+		return report, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := auditHistory(m.ctx, dir, opts, &report); err != nil {
+		return report, err
+	}
+
+	blobs, err := listBlobs(m.ctx, dir)
+	if err != nil {
+		return report, err
+	}
+	auditLargeFiles(blobs, opts.MaxFileSize, &report)
+	if err := auditLFSPointers(m.ctx, dir, &report); err != nil {
+		return report, err
+	}
+	if err := auditSecrets(m.ctx, dir, blobs, &report); err != nil {
+		return report, err
+	}
+
+	logger.Info("audit repository finished",
+		"risk", report.Risk,
+		"findings", len(report.Findings)+report.Omitted,
+	)
+	return report, nil
+}
+
+// auditHistory check the number of commits and the packed size
+func auditHistory(ctx context.Context, dir string, opts AuditOption, report *AuditReport) error {
+	out, err := gitOutput(ctx, dir, "rev-list", "--all", "--count")
+	if err != nil {
+		return err
+	}
+	report.Commits, err = strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return err
+	}
+
+	out, err = gitOutput(ctx, dir, "count-objects", "-v")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok || (key != "size" && key != "size-pack") {
+			continue
+		}
+		kib, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return err
+		}
+		report.Size += kib * 1024
+	}
+
+	if opts.MaxCommits > 0 && report.Commits > opts.MaxCommits {
+		report.add(Finding{
+			Check:   checkCommits,
+			Risk:    RiskMedium,
+			Message: fmt.Sprintf("%d commits exceed %d", report.Commits, opts.MaxCommits),
+		})
+	}
+	if opts.MaxRepoSize > 0 && report.Size > opts.MaxRepoSize {
+		report.add(Finding{
+			Check:   checkHistorySize,
+			Risk:    RiskMedium,
+			Message: fmt.Sprintf("repository size %s exceeds %s", formatSize(report.Size), formatSize(opts.MaxRepoSize)),
+		})
+	}
+
+	return nil
+}
+
+// auditLargeFiles report the largest version of each file over the limit
+func auditLargeFiles(blobs []blob, maxSize int64, report *AuditReport) {
+	if maxSize <= 0 {
+		return
+	}
+
+	largest := map[string]int64{}
+	for _, b := range blobs {
+		if b.Size > maxSize && b.Size > largest[b.Path] {
+			largest[b.Path] = b.Size
+		}
+	}
+	paths := make([]string, 0, len(largest))
+	for p := range largest {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return largest[paths[i]] > largest[paths[j]] })
+
+	for _, p := range paths {
+		report.add(Finding{
+			Check:   checkLargeFile,
+			Risk:    RiskHigh,
+			Path:    p,
+			Message: fmt.Sprintf("file size %s exceeds %s", formatSize(largest[p]), formatSize(maxSize)),
+		})
+	}
+}
+
+// auditLFSPointers report the files of the default branch tracked by git lfs
+// in .gitattributes, but committed as regular files.
+func auditLFSPointers(ctx context.Context, dir string, report *AuditReport) error {
+	// empty repositories and repositories without attributes have nothing to check
+	attributes, err := gitOutput(ctx, dir, "show", "HEAD:.gitattributes")
+	if err != nil {
+		return nil
+	}
+	patterns := lfsPatterns(attributes)
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	out, err := gitOutput(ctx, dir, "ls-tree", "-r", "-l", "HEAD")
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	candidates := map[string][]string{}
+	for _, line := range strings.Split(out, "\n") {
+		meta, name, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) < 4 || fields[1] != "blob" || !matchPatterns(patterns, name) {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		if size >= lfsPointerMaxSize {
+			missing = append(missing, name)
+			continue
+		}
+		candidates[fields[2]] = append(candidates[fields[2]], name)
+	}
+
+	oids := make([]string, 0, len(candidates))
+	for oid := range candidates {
+		oids = append(oids, oid)
+	}
+	err = readBlobs(ctx, dir, oids, func(oid string, data []byte) {
+		if !bytes.HasPrefix(data, []byte(lfsPointerPrefix)) {
+			missing = append(missing, candidates[oid]...)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(missing)
+	for _, name := range missing {
+		report.add(Finding{
+			Check:   checkLFSPointer,
+			Risk:    RiskMedium,
+			Path:    name,
+			Message: "tracked by git lfs but committed without lfs pointer",
+		})
+	}
+
+	return nil
+}
+
+// auditSecrets scan the text files of the whole history for secrets, each
+// rule is reported once per path.
+func auditSecrets(ctx context.Context, dir string, blobs []blob, report *AuditReport) error {
+	paths := map[string]string{}
+	oids := []string{}
+	for _, b := range blobs {
+		if b.Size <= secretScanMaxSize {
+			paths[b.Oid] = b.Path
+			oids = append(oids, b.Oid)
+		}
+	}
+
+	seen := map[string]bool{}
+	return readBlobs(ctx, dir, oids, func(oid string, data []byte) {
+		// skip binary files
+		if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return
+		}
+		for _, rule := range secretRules {
+			match := rule.Pattern.Find(data)
+			if match == nil || seen[rule.Name+"\x00"+paths[oid]] {
+				continue
+			}
+			seen[rule.Name+"\x00"+paths[oid]] = true
+			report.add(Finding{
+				Check:   checkSecret,
+				Risk:    rule.Risk,
+				Path:    paths[oid],
+				Message: fmt.Sprintf("%s %s", rule.Name, redactSecret(string(match))),
+			})
+		}
+	})
+}
+
+// listBlobs list all blobs of the history with the first path they appear at
+func listBlobs(ctx context.Context, dir string) ([]blob, error) {
+	objects, err := gitOutput(ctx, dir, "rev-list", "--objects", "--all")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "--batch-check=%(objecttype) %(objectname) %(objectsize) %(rest)")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(objects)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	blobs := []blob{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 || fields[0] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob{Oid: fields[1], Size: size, Path: fields[3]})
+	}
+
+	return blobs, nil
+}
+
+// readBlobs stream the content of the blobs to fn
+func readBlobs(ctx context.Context, dir string, oids []string, fn func(oid string, data []byte)) error {
+	if len(oids) == 0 {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "--batch")
+	cmd.Dir = dir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go func() {
+		w := bufio.NewWriter(stdin)
+		for _, oid := range oids {
+			fmt.Fprintln(w, oid)
+		}
+		_ = w.Flush()
+		stdin.Close()
+	}()
+
+	readErr := func() error {
+		r := bufio.NewReader(stdout)
+		for range oids {
+			// <oid> <type> <size>, followed by the content and a newline
+			header, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			fields := strings.Fields(header)
+			if len(fields) < 3 {
+				return fmt.Errorf("git cat-file: object %s", strings.TrimSpace(header))
+			}
+			size, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return err
+			}
+			data := make([]byte, size+1)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			fn(fields[0], data[:size])
+		}
+		return nil
+	}()
+	if readErr != nil {
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git cat-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return readErr
+}
+
+// lfsPatterns get the patterns with the lfs filter of the .gitattributes file
+func lfsPatterns(attributes string) []string {
+	patterns := []string{}
+	for _, line := range strings.Split(attributes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, attr := range fields[1:] {
+			if attr == "filter=lfs" {
+				patterns = append(patterns, fields[0])
+				break
+			}
+		}
+	}
+	return patterns
+}
+
+// matchPatterns check the path matches one of the gitattributes patterns.
+// Patterns without slash match the file name, and ** is supported as
+// leading or trailing directory wildcard.
+func matchPatterns(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchAttribute(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAttribute(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	pattern = strings.TrimPrefix(pattern, "/")
+	if rest, ok := strings.CutPrefix(pattern, "**/"); ok {
+		parts := strings.Split(name, "/")
+		for i := range parts {
+			if matchAttribute("/"+rest, strings.Join(parts[i:], "/")) {
+				return true
+			}
+		}
+		return false
+	}
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		for d := path.Dir(name); d != "."; d = path.Dir(d) {
+			if ok, _ := path.Match(dir, d); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// redactSecret keep only the start of the secret in the report
+func redactSecret(secret string) string {
+	if strings.HasPrefix(secret, "-----BEGIN") {
+		return ""
+	}
+	if len(secret) > 8 {
+		return secret[:4] + "****"
+	}
+	return "****"
+}
+
+func formatSize(size int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+}
+
+// WriteAuditReports write the audit reports as json file
+func WriteAuditReports(file string, reports []AuditReport) error {
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, append(data, '\n'), 0o644)
+}
+
+// LoadAuditReports read the audit reports of the json file by source
+func LoadAuditReports(file string) (map[string]AuditReport, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []AuditReport{}
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, fmt.Errorf("audit report %s: %w", file, err)
+	}
+	if len(reports) == 0 {
+		return nil, errors.New("audit report " + file + " has no repositories")
+	}
+
+	result := map[string]AuditReport{}
+	for _, r := range reports {
+		result[r.Source] = r
+	}
+	return result, nil
+}
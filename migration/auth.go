@@ -0,0 +1,122 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	bitbucketv1 "github.com/gfleury/go-bitbucket-v1"
+	"github.com/spf13/viper"
+)
+
+// AuthType authentication mode for Bitbucket requests
+type AuthType string
+
+const (
+	// AuthToken send the HTTP access token as a bearer token
+	AuthToken AuthType = "token"
+	// AuthBasic send the username and password as basic auth
+	AuthBasic AuthType = "basic"
+)
+
+// Credential holds the Bitbucket authentication data
+type Credential struct {
+	AuthType AuthType
+	Username string
+	Password string
+	Token    string
+}
+
+// loadCredential load credential from config with the given prefix.
+// missing values fall back to the parent credential.
+func loadCredential(ctx context.Context, prefix string, parent Credential) (Credential, error) {
+	password, err := resolveSecret(ctx, prefix+".password")
+	if err != nil {
+		return Credential{}, err
+	}
+	token, err := resolveSecret(ctx, prefix+".token")
+	if err != nil {
+		return Credential{}, err
+	}
+
+	c := Credential{
+		AuthType: AuthType(strings.ToLower(viper.GetString(prefix + ".auth-type"))),
+		Username: viper.GetString(prefix + ".username"),
+		Password: password,
+		Token:    token,
+	}
+
+	if c.AuthType == "" {
+		c.AuthType = parent.AuthType
+	}
+	if c.Username == "" {
+		c.Username = parent.Username
+	}
+	if c.Password == "" {
+		c.Password = parent.Password
+	}
+	if c.Token == "" {
+		c.Token = parent.Token
+	}
+
+	return c, nil
+}
+
+// Validate check the credential has the values required by the auth type
+func (c Credential) Validate() error {
+	switch c.AuthType {
+	case AuthToken:
+		if c.Token == "" {
+			return errors.New("missing access token")
+		}
+	case AuthBasic:
+		if c.Username == "" || c.Password == "" {
+			return errors.New("missing username or password")
+		}
+	default:
+		return fmt.Errorf("auth type %q invalid, must be %q or %q", c.AuthType, AuthToken, AuthBasic)
+	}
+
+	return nil
+}
+
+// WithToken returns a copy of the credential using the access token
+func (c Credential) WithToken(token string) Credential {
+	c.AuthType = AuthToken
+	c.Token = token
+	return c
+}
+
+// Context returns a context carrying the credential for the bitbucket client
+func (c Credential) Context(ctx context.Context) context.Context {
+	if c.AuthType == AuthBasic {
+		return context.WithValue(ctx, bitbucketv1.ContextBasicAuth, bitbucketv1.BasicAuth{
+			UserName: c.Username,
+			Password: c.Password,
+		})
+	}
+
+	return context.WithValue(ctx, bitbucketv1.ContextAccessToken, c.Token)
+}
+
+// Apply set the authorization header of the request
+func (c Credential) Apply(req *http.Request) {
+	if c.AuthType == AuthBasic {
+		req.SetBasicAuth(c.Username, c.Password)
+		return
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+}
+
+// BasicAuth returns the username and password used for git clone.
+// access tokens are used as the password.
+func (c Credential) BasicAuth() (string, string) {
+	if c.AuthType == AuthBasic {
+		return c.Username, c.Password
+	}
+
+	return c.Username, c.Token
+}
@@ -1,12 +1,16 @@
 package migration
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	bitbucketv1 "github.com/gfleury/go-bitbucket-v1"
@@ -15,15 +19,29 @@ import (
 
 // NewBitbucket creates a new instance of the bitbucket struct.
 func NewBitbucket(ctx context.Context, logger *slog.Logger) (*bitbucket, error) {
+	auth, err := loadCredential(ctx, "bitbucket", Credential{AuthType: AuthToken})
+	if err != nil {
+		return nil, err
+	}
+	cloneAuth, err := loadCredential(ctx, "bitbucket.clone", auth)
+	if err != nil {
+		return nil, err
+	}
+
 	b := &bitbucket{
-		ctx:      ctx,
-		server:   viper.GetString("bitbucket.server"),
-		Token:    viper.GetString("bitbucket.token"),
-		Username: viper.GetString("bitbucket.username"),
-		logger:   logger,
+		// the run timeout only stops starting new repositories, the API
+		// requests of a running repository migration must not be canceled
+		ctx:          context.WithoutCancel(ctx),
+		server:       viper.GetString("bitbucket.server"),
+		apiAuth:      auth,
+		cloneAuth:    cloneAuth,
+		accessTokens: viper.GetStringMapString("bitbucket.access-tokens"),
+		clients:      make(map[string]*bitbucketv1.APIClient),
+		limiter:      newRateLimiter("bitbucket"),
+		logger:       logger,
 	}
 
-	err := b.init()
+	err = b.init()
 	if err != nil {
 		return nil, err
 	}
@@ -33,50 +51,230 @@ func NewBitbucket(ctx context.Context, logger *slog.Logger) (*bitbucket, error)
 
 // bitbucket is a struct that holds the bitbucket client.
 type bitbucket struct {
-	ctx      context.Context
-	server   string
-	Token    string
-	Username string
-	client   *bitbucketv1.APIClient
-	logger   *slog.Logger
+	ctx          context.Context
+	server       string
+	apiAuth      Credential
+	cloneAuth    Credential
+	accessTokens map[string]string
+	httpClient   *http.Client
+	client       *bitbucketv1.APIClient
+	clients      map[string]*bitbucketv1.APIClient
+	limiter      *rateLimiter
+	logger       *slog.Logger
 }
 
 // init initializes the bitbucket client.
 func (b *bitbucket) init() error {
-	if b.server == "" || b.Username == "" || b.Token == "" {
-		return errors.New("mission bitbucket server, username or token")
+	if b.server == "" {
+		return errors.New("missing bitbucket server")
+	}
+	if err := b.apiAuth.Validate(); err != nil {
+		return fmt.Errorf("bitbucket api auth: %w", err)
+	}
+	if err := b.cloneAuth.Validate(); err != nil {
+		return fmt.Errorf("bitbucket clone auth: %w", err)
+	}
+	if b.cloneAuth.Username == "" {
+		return errors.New("missing bitbucket clone username")
 	}
 
 	b.server = strings.TrimRight(b.server, "/")
 
-	ctx := context.WithValue(b.ctx, bitbucketv1.ContextAccessToken, b.Token)
-	b.client = bitbucketv1.NewAPIClient(
-		ctx,
+	httpClient, err := newHTTPClient("bitbucket", b.logger, b.limiter)
+	if err != nil {
+		return fmt.Errorf("bitbucket http client: %w", err)
+	}
+	b.httpClient = httpClient
+	b.client = b.newClient(b.apiAuth)
+
+	return nil
+}
+
+// newClient creates a bitbucket client using the credential.
+func (b *bitbucket) newClient(auth Credential) *bitbucketv1.APIClient {
+	return bitbucketv1.NewAPIClient(
+		auth.Context(b.ctx),
 		bitbucketv1.NewConfiguration(
 			b.server+"/rest",
 			func(cfg *bitbucketv1.Configuration) {
-				certs, _ := x509.SystemCertPool()
-				// add new http client for skip verify
-				httpClient := &http.Client{
-					Transport: &http.Transport{
-						TLSClientConfig: &tls.Config{
-							RootCAs:            certs,
-							InsecureSkipVerify: true,
-						},
-					},
-				}
-				cfg.HTTPClient = httpClient
+				cfg.HTTPClient = b.httpClient
 			},
 		),
 	)
+}
 
-	return nil
+// accessToken get the project or repository access token.
+// repository token takes precedence over project token.
+func (b *bitbucket) accessToken(projectKey, repoSlug string) string {
+	if repoSlug != "" {
+		if token, ok := b.accessTokens[strings.ToLower(projectKey+"/"+repoSlug)]; ok {
+			return token
+		}
+	}
+
+	return b.accessTokens[strings.ToLower(projectKey)]
+}
+
+// apiClient get the bitbucket client for the project or repository.
+func (b *bitbucket) apiClient(projectKey, repoSlug string) *bitbucketv1.APIClient {
+	token := b.accessToken(projectKey, repoSlug)
+	if token == "" {
+		return b.client
+	}
+
+	if client, ok := b.clients[token]; ok {
+		return client
+	}
+
+	client := b.newClient(b.apiAuth.WithToken(token))
+	b.clients[token] = client
+	return client
+}
+
+// credential get the api credential for the project or repository.
+func (b *bitbucket) credential(projectKey, repoSlug string) Credential {
+	if token := b.accessToken(projectKey, repoSlug); token != "" {
+		return b.apiAuth.WithToken(token)
+	}
+
+	return b.apiAuth
+}
+
+// APIError bitbucket REST API error response
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("bitbucket api status: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// do send the request to the bitbucket REST API for endpoints which are not
+// supported by the bitbucket client. The path is relative to /rest, and the
+// JSON response is decoded into out if it isn't nil.
+func (b *bitbucket) do(projectKey, repoSlug, method, path string, query url.Values, body, out interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := b.server + "/rest" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(b.ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	b.credential(projectKey, repoSlug).Apply(req)
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp, &APIError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+// paged request all pages of the paged bitbucket API, or the pages up to
+// the max number of values if max is greater than zero. The values of each
+// page are passed to fn.
+func (b *bitbucket) paged(projectKey, repoSlug, path string, query url.Values, max int, fn func(values json.RawMessage) error) error {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+
+	start, count := 0, 0
+	for {
+		limit := 100
+		if max > 0 {
+			limit = min(limit, max-count)
+		}
+		q.Set("start", strconv.Itoa(start))
+		q.Set("limit", strconv.Itoa(limit))
+
+		var page struct {
+			Values        json.RawMessage `json:"values"`
+			Size          int             `json:"size"`
+			IsLastPage    bool            `json:"isLastPage"`
+			NextPageStart int             `json:"nextPageStart"`
+		}
+		if _, err := b.do(projectKey, repoSlug, http.MethodGet, path, q, nil, &page); err != nil {
+			return err
+		}
+		if err := fn(page.Values); err != nil {
+			return err
+		}
+
+		count += page.Size
+		if page.IsLastPage || page.Size == 0 || (max > 0 && count >= max) {
+			return nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+// projectPath get the REST API path of the project
+func projectPath(projectKey string) string {
+	return "/api/1.0/projects/" + url.PathEscape(projectKey)
+}
+
+// repoPath get the REST API path of the repository
+func repoPath(projectKey, repoSlug string) string {
+	return projectPath(projectKey) + "/repos/" + url.PathEscape(repoSlug)
+}
+
+// CloneRemote get the git remote for cloning the repository.
+func (b *bitbucket) CloneRemote(projectKey, repoSlug, cloneAddr string) GitRemote {
+	remote := GitRemote{
+		URL: cloneAddr,
+		TLS: loadTLSOption("bitbucket"),
+	}
+	if strings.HasPrefix(cloneAddr, "http://") || strings.HasPrefix(cloneAddr, "https://") {
+		remote.Username, remote.Password = b.CloneCredential(projectKey, repoSlug)
+	} else {
+		remote.SSHKey = viper.GetString("bitbucket.ssh-key")
+	}
+
+	return remote
+}
+
+// CloneCredential get the username and password for git clone.
+func (b *bitbucket) CloneCredential(projectKey, repoSlug string) (string, string) {
+	auth := b.cloneAuth
+	if token := b.accessToken(projectKey, repoSlug); token != "" {
+		auth = auth.WithToken(token)
+	}
+
+	return auth.BasicAuth()
 }
 
 // GetUsersPermissionFromProject get users permission from project
 func (b *bitbucket) GetUsersPermissionFromProject(projectKey string) ([]bitbucketv1.UserPermission, error) {
 	// check project user permission
-	response, err := b.client.DefaultApi.GetUsersWithAnyPermission_23(
+	response, err := b.apiClient(projectKey, "").DefaultApi.GetUsersWithAnyPermission_23(
 		projectKey,
 		map[string]interface{}{
 			"limit": 200,
@@ -91,7 +289,7 @@ func (b *bitbucket) GetUsersPermissionFromProject(projectKey string) ([]bitbucke
 // GetUsersPermissionFromRepo get users permission from repo
 func (b *bitbucket) GetUsersPermissionFromRepo(projectKey, repoSlug string) ([]bitbucketv1.UserPermission, error) {
 	// check project user permission
-	response, err := b.client.DefaultApi.GetUsersWithAnyPermission_24(
+	response, err := b.apiClient(projectKey, repoSlug).DefaultApi.GetUsersWithAnyPermission_24(
 		projectKey,
 		repoSlug,
 		map[string]interface{}{
@@ -107,7 +305,7 @@ func (b *bitbucket) GetUsersPermissionFromRepo(projectKey, repoSlug string) ([]b
 // GetGroupsPermissionFromProject get groups permission from project
 func (b *bitbucket) GetGroupsPermissionFromProject(projectKey string) ([]bitbucketv1.GroupPermission, error) {
 	// check project group permission
-	response, err := b.client.DefaultApi.GetGroupsWithAnyPermission_12(
+	response, err := b.apiClient(projectKey, "").DefaultApi.GetGroupsWithAnyPermission_12(
 		projectKey,
 		map[string]interface{}{
 			"limit": 200,
@@ -122,7 +320,7 @@ func (b *bitbucket) GetGroupsPermissionFromProject(projectKey string) ([]bitbuck
 // GetGroupsPermissionFromRepo get groups permission from repo
 func (b *bitbucket) GetGroupsPermissionFromRepo(projectKey, repoSlug string) ([]bitbucketv1.GroupPermission, error) {
 	// check project group permission
-	response, err := b.client.DefaultApi.GetGroupsWithAnyPermission_13(
+	response, err := b.apiClient(projectKey, repoSlug).DefaultApi.GetGroupsWithAnyPermission_13(
 		projectKey,
 		repoSlug,
 		map[string]interface{}{
@@ -152,7 +350,7 @@ func (b *bitbucket) GetUsersFromGroup(g string) ([]bitbucketv1.User, error) {
 
 // GetProject get project
 func (b *bitbucket) GetProject(projectKey string) (bitbucketv1.Project, error) {
-	response, err := b.client.DefaultApi.GetProject(projectKey)
+	response, err := b.apiClient(projectKey, "").DefaultApi.GetProject(projectKey)
 	if err != nil {
 		return bitbucketv1.Project{}, err
 	}
@@ -160,24 +358,37 @@ func (b *bitbucket) GetProject(projectKey string) (bitbucketv1.Project, error) {
 	return bitbucketv1.GetRrojectResponse(response)
 }
 
+// Repository bitbucket repository with the archived flag, which was added
+// in Bitbucket 8 and is missing in the bitbucket client.
+type Repository struct {
+	bitbucketv1.Repository
+	Archived bool `json:"archived"`
+}
+
 // GetRepo get repo
-func (b *bitbucket) GetRepo(projectKey, repoSlug string) (bitbucketv1.Repository, error) {
-	response, err := b.client.DefaultApi.GetRepository(projectKey, repoSlug)
-	if err != nil {
-		return bitbucketv1.Repository{}, err
+func (b *bitbucket) GetRepo(projectKey, repoSlug string) (Repository, error) {
+	var repo Repository
+	if _, err := b.do(projectKey, repoSlug, http.MethodGet, repoPath(projectKey, repoSlug), nil, nil, &repo); err != nil {
+		return Repository{}, err
 	}
 
-	return bitbucketv1.GetRepositoryResponse(response)
+	return repo, nil
 }
 
 // GetRepositories get repositories from project
-func (b *bitbucket) GetRepositories(projectKey string) ([]bitbucketv1.Repository, error) {
-	response, err := b.client.DefaultApi.GetRepositoriesWithOptions(projectKey, map[string]interface{}{
-		"limit": 200,
+func (b *bitbucket) GetRepositories(projectKey string) ([]Repository, error) {
+	repos := []Repository{}
+	err := b.paged(projectKey, "", projectPath(projectKey)+"/repos", nil, 0, func(values json.RawMessage) error {
+		var page []Repository
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		repos = append(repos, page...)
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return bitbucketv1.GetRepositoriesResponse(response)
+	return repos, nil
 }
@@ -0,0 +1,229 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	gsdk "code.gitea.io/sdk/gitea"
+)
+
+// maxStatusDescription gitea limit of the commit status description
+const maxStatusDescription = 255
+
+// BuildStatusOption migrate the build statuses and code insights reports
+type BuildStatusOption struct {
+	Enabled bool
+	// Depth number of recent commits of the default branch, besides the
+	// branch heads
+	Depth int
+}
+
+// BuildStatus bitbucket build status of a commit
+type BuildStatus struct {
+	State       string `json:"state"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+// InsightReport bitbucket code insights report of a commit
+type InsightReport struct {
+	Key     string `json:"key"`
+	Title   string `json:"title"`
+	Result  string `json:"result"`
+	Link    string `json:"link"`
+	Details string `json:"details"`
+}
+
+// buildStates gitea status state of the bitbucket build state
+var buildStates = map[string]gsdk.StatusState{
+	"SUCCESSFUL": gsdk.StatusSuccess,
+	"FAILED":     gsdk.StatusFailure,
+	"INPROGRESS": gsdk.StatusPending,
+	"CANCELLED":  gsdk.StatusError,
+	"UNKNOWN":    gsdk.StatusWarning,
+}
+
+// insightResults gitea status state of the code insights report result
+var insightResults = map[string]gsdk.StatusState{
+	"PASS": gsdk.StatusSuccess,
+	"FAIL": gsdk.StatusFailure,
+}
+
+// GetStatusCommits get the head commits of all branches and the recent
+// commits of the default branch.
+func (b *bitbucket) GetStatusCommits(projectKey, repoSlug string, depth int) ([]string, error) {
+	commits := []string{}
+	seen := map[string]bool{}
+	add := func(values json.RawMessage, field string) error {
+		var page []map[string]interface{}
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, v := range page {
+			id, _ := v[field].(string)
+			if id != "" && !seen[id] {
+				seen[id] = true
+				commits = append(commits, id)
+			}
+		}
+		return nil
+	}
+
+	err := b.paged(projectKey, repoSlug, repoPath(projectKey, repoSlug)+"/branches", nil, 0, func(values json.RawMessage) error {
+		return add(values, "latestCommit")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if depth > 0 {
+		err = b.paged(projectKey, repoSlug, repoPath(projectKey, repoSlug)+"/commits", nil, depth, func(values json.RawMessage) error {
+			return add(values, "id")
+		})
+		var apiErr *APIError
+		// empty repositories have no commits
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			err = nil
+		}
+	}
+
+	return commits, err
+}
+
+// GetBuildStatuses get the build statuses of the commit
+func (b *bitbucket) GetBuildStatuses(projectKey, repoSlug, commit string) ([]BuildStatus, error) {
+	statuses := []BuildStatus{}
+	err := b.paged(projectKey, repoSlug, "/build-status/1.0/commits/"+url.PathEscape(commit), nil, 0, func(values json.RawMessage) error {
+		var page []BuildStatus
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		statuses = append(statuses, page...)
+		return nil
+	})
+
+	return statuses, err
+}
+
+// GetInsightReports get the code insights reports of the commit, returns
+// nothing if code insights isn't available.
+func (b *bitbucket) GetInsightReports(projectKey, repoSlug, commit string) ([]InsightReport, error) {
+	path := "/insights/1.0/projects/" + url.PathEscape(projectKey) + "/repos/" + url.PathEscape(repoSlug) +
+		"/commits/" + url.PathEscape(commit) + "/reports"
+	reports := []InsightReport{}
+	err := b.paged(projectKey, repoSlug, path, nil, 0, func(values json.RawMessage) error {
+		var page []InsightReport
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		reports = append(reports, page...)
+		return nil
+	})
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	return reports, err
+}
+
+// CreateStatusOption create commit status option
+type CreateStatusOption struct {
+	State       gsdk.StatusState
+	TargetURL   string
+	Description string
+	Context     string
+}
+
+// CreateStatus create the commit status
+func (g *gitea) CreateStatus(owner, name, sha string, opts CreateStatusOption) error {
+	description := opts.Description
+	if len(description) > maxStatusDescription {
+		description = description[:maxStatusDescription]
+	}
+	_, _, err := g.client.CreateStatus(owner, name, sha, gsdk.CreateStatusOption{
+		State:       opts.State,
+		TargetURL:   opts.TargetURL,
+		Description: description,
+		Context:     opts.Context,
+	})
+	return err
+}
+
+// commitStatuses convert the build statuses and insights reports to
+// gitea commit statuses, keyed by the bitbucket key.
+func commitStatuses(builds []BuildStatus, reports []InsightReport) []CreateStatusOption {
+	statuses := []CreateStatusOption{}
+	for _, b := range builds {
+		state, ok := buildStates[b.State]
+		if !ok {
+			continue
+		}
+		description := b.Description
+		if description == "" {
+			description = b.Name
+		}
+		statuses = append(statuses, CreateStatusOption{
+			State:       state,
+			TargetURL:   b.URL,
+			Description: description,
+			Context:     b.Key,
+		})
+	}
+
+	for _, r := range reports {
+		// reports without result don't have a state
+		state, ok := insightResults[r.Result]
+		if !ok {
+			continue
+		}
+		description := r.Details
+		if description == "" {
+			description = r.Title
+		}
+		statuses = append(statuses, CreateStatusOption{
+			State:       state,
+			TargetURL:   r.Link,
+			Description: description,
+			Context:     r.Key,
+		})
+	}
+
+	return statuses
+}
+
+// migrateBuildStatuses post the bitbucket build statuses and code insights
+// results of the branch heads and recent commits as gitea commit statuses.
+func (m *migration) migrateBuildStatuses(opts MigrateNewRepoOption) error {
+	logger := m.repoLogger(opts)
+	commits, err := m.Bitbucket.GetStatusCommits(opts.ProjectKey, opts.RepoSlug, m.buildStatus.Depth)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, commit := range commits {
+		builds, err := m.Bitbucket.GetBuildStatuses(opts.ProjectKey, opts.RepoSlug, commit)
+		if err != nil {
+			return err
+		}
+		reports, err := m.Bitbucket.GetInsightReports(opts.ProjectKey, opts.RepoSlug, commit)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range commitStatuses(builds, reports) {
+			if err := m.Gitea.CreateStatus(opts.Owner, opts.Name, commit, status); err != nil {
+				return err
+			}
+			total++
+		}
+	}
+
+	logger.Info("build statuses migrated", "commits", len(commits), "statuses", total)
+	return nil
+}
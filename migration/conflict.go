@@ -0,0 +1,152 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConflictPolicy action when the target repository already exists in gitea
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keep the existing repository and skip the migration
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictFail stop the whole run
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictRename migrate into a new repository name with a number suffix
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictUpdate only update the description, visibility and permissions
+	ConflictUpdate ConflictPolicy = "update"
+	// ConflictRecreate delete the existing repository and migrate again
+	ConflictRecreate ConflictPolicy = "recreate"
+)
+
+// ConflictPolicies all conflict policies
+var ConflictPolicies = []ConflictPolicy{
+	ConflictSkip, ConflictFail, ConflictRename, ConflictUpdate, ConflictRecreate,
+}
+
+// ParseConflictPolicy check the conflict policy name
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	names := []string{}
+	for _, p := range ConflictPolicies {
+		if string(p) == name {
+			return p, nil
+		}
+		names = append(names, string(p))
+	}
+
+	return "", fmt.Errorf("conflict policy %q invalid, must be one of %s", name, strings.Join(names, ", "))
+}
+
+// maxRenameSuffix limit of the rename suffix number
+const maxRenameSuffix = 100
+
+var (
+	// ErrConflict the target repository exists with the fail policy
+	ErrConflict = errors.New("target repository already exists")
+	// errSkipped the migration was skipped by the conflict policy
+	errSkipped = errors.New("migration skipped")
+)
+
+// ExistingTargets get the planned migrations whose target repository exists
+func (m *migration) ExistingTargets(entries []ManifestEntry) ([]ManifestEntry, error) {
+	existing := []ManifestEntry{}
+	for _, e := range entries {
+		repo, err := m.Gitea.GetRepo(e.TargetOwner, e.TargetName)
+		if err != nil {
+			return nil, err
+		}
+		if repo != nil {
+			existing = append(existing, e)
+		}
+	}
+
+	return existing, nil
+}
+
+// resolveConflict apply the conflict policy if the target repository exists.
+// It returns the update or recreate policy when the existing repository has
+// to be updated or deleted, and errSkipped when the repository shouldn't be
+// migrated. The rename policy changes the target name of the entry, avoiding
+// the names taken by the run.
+func (m *migration) resolveConflict(e *ManifestEntry, taken map[string]bool) (ConflictPolicy, error) {
+	repo, err := m.Gitea.GetRepo(e.TargetOwner, e.TargetName)
+	if err != nil {
+		return "", err
+	}
+	if repo == nil {
+		return "", nil
+	}
+
+	logger := m.Logger.With(
+		"owner", e.TargetOwner,
+		"name", e.TargetName,
+		"policy", m.conflict,
+	)
+	switch m.conflict {
+	case ConflictFail:
+		logger.Error("target repository exists, stop migration")
+		return "", fmt.Errorf("%s: %w", e.Target(), ErrConflict)
+	case ConflictRename:
+		for i := 1; i <= maxRenameSuffix; i++ {
+			name := e.TargetName + "-" + strconv.Itoa(i)
+			if taken[strings.ToLower(e.TargetOwner+"/"+name)] {
+				continue
+			}
+			if err := validateRepoName(name); err != nil {
+				return "", err
+			}
+			repo, err := m.Gitea.GetRepo(e.TargetOwner, name)
+			if err != nil {
+				return "", err
+			}
+			if repo == nil {
+				logger.Warn("target repository exists, rename", "new_name", name)
+				taken[strings.ToLower(e.TargetOwner+"/"+name)] = true
+				e.TargetName = name
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("no free name for %s after %d attempts", e.Target(), maxRenameSuffix)
+	case ConflictUpdate:
+		logger.Info("target repository exists, update metadata")
+		return ConflictUpdate, nil
+	case ConflictRecreate:
+		logger.Warn("target repository exists, delete and recreate")
+		return ConflictRecreate, nil
+	default:
+		logger.Info("target repository exists, skip")
+		return "", errSkipped
+	}
+}
+
+// updateRepo update the metadata and permissions of the existing repository
+func (m *migration) updateRepo(opts MigrateNewRepoOption) error {
+	m.Logger.Info("start update repo",
+		"owner", opts.Owner,
+		"name", opts.Name,
+	)
+	steps := []repoStep{
+		{name: "metadata", run: func() error {
+			_, err := m.Gitea.EditRepo(opts.Owner, opts.Name, EditRepoOption{
+				Description: &opts.Description,
+				Private:     &opts.Private,
+			})
+			return err
+		}},
+		{name: "permissions", run: func() error { return m.migrateRepoPermission(opts) }},
+		bestEffort("settings", func() error { return m.migrateRepoSettings(opts) }),
+		bestEffort("topics", func() error { return m.migrateRepoTopics(opts) }),
+	}
+	if m.jira.Enabled {
+		steps = append(steps, bestEffort("jira", func() error { return m.migrateJira(opts) }))
+	}
+	if m.mergeChecks {
+		steps = append(steps, bestEffort("merge checks", func() error { return m.migrateMergeChecks(opts) }))
+	}
+
+	return m.runSteps(opts, steps)
+}
@@ -10,3 +10,10 @@ const (
 	GiteaProjectRead  = "read"
 	GiteaRepoCreate   = "create"
 )
+
+const (
+	// MinBitbucketVersion minimum supported Bitbucket Server version
+	MinBitbucketVersion = "8.0.0"
+	// MinGiteaVersion minimum supported Gitea version
+	MinGiteaVersion = "1.21.0"
+)
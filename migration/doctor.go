@@ -0,0 +1,268 @@
+package migration
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	gsdk "code.gitea.io/sdk/gitea"
+	version "github.com/hashicorp/go-version"
+)
+
+// CheckStatus doctor check status
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckFail CheckStatus = "fail"
+	CheckWarn CheckStatus = "warn"
+)
+
+// Check doctor check result
+type Check struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+// DoctorOption doctor option
+type DoctorOption struct {
+	ProjectKeys []string
+}
+
+// doctor collects the check results
+type doctor struct {
+	checks []Check
+}
+
+func (d *doctor) pass(name, format string, args ...interface{}) {
+	d.checks = append(d.checks, Check{Name: name, Status: CheckPass, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *doctor) fail(name, format string, args ...interface{}) {
+	d.checks = append(d.checks, Check{Name: name, Status: CheckFail, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *doctor) warn(name, format string, args ...interface{}) {
+	d.checks = append(d.checks, Check{Name: name, Status: CheckWarn, Message: fmt.Sprintf(format, args...)})
+}
+
+// connection check the connection error is caused by TLS
+func (d *doctor) connection(server string, err error) {
+	if isTLSError(err) {
+		d.fail(server+" tls", "%v", err)
+		return
+	}
+	d.fail(server+" reachable", "%v", err)
+}
+
+// tls check the TLS verification of the server
+func (d *doctor) tls(server string, secure bool) {
+	switch {
+	case !secure:
+		d.warn(server+" tls", "server doesn't use https")
+	case loadTLSOption(server).SkipVerify:
+		d.warn(server+" tls", "certificate verification is disabled by %s.skip-verify", server)
+	default:
+		d.pass(server+" tls", "certificate verified")
+	}
+}
+
+// Doctor validates the connectivity and privileges of both servers
+// before running a migration.
+func Doctor(ctx context.Context, logger *slog.Logger, opts DoctorOption) []Check {
+	return append(
+		CheckBitbucket(ctx, logger, opts.ProjectKeys),
+		CheckGitea(ctx, logger)...,
+	)
+}
+
+// CheckBitbucket validates the bitbucket connectivity and privileges
+func CheckBitbucket(ctx context.Context, logger *slog.Logger, projectKeys []string) []Check {
+	d := &doctor{}
+	d.bitbucket(ctx, logger, projectKeys)
+	return d.checks
+}
+
+// CheckGitea validates the gitea connectivity and privileges
+func CheckGitea(ctx context.Context, logger *slog.Logger) []Check {
+	d := &doctor{}
+	d.gitea(ctx, logger)
+	return d.checks
+}
+
+func (d *doctor) bitbucket(ctx context.Context, logger *slog.Logger, projectKeys []string) {
+	b, err := NewBitbucket(ctx, logger)
+	if err != nil {
+		d.fail("bitbucket config", "%v", err)
+		return
+	}
+
+	var props struct {
+		Version     string `json:"version"`
+		DisplayName string `json:"displayName"`
+	}
+	resp, err := b.do("", "", http.MethodGet, "/api/1.0/application-properties", nil, nil, &props)
+	if resp == nil {
+		d.connection("bitbucket", err)
+		return
+	}
+	d.pass("bitbucket reachable", "%s", b.server)
+	d.tls("bitbucket", resp.TLS != nil)
+
+	if err != nil {
+		d.fail("bitbucket authentication", "%v", err)
+		return
+	}
+	if user := resp.Header.Get("X-AUSERNAME"); user != "" {
+		d.pass("bitbucket authentication", "authenticated as %s", user)
+	} else {
+		d.fail("bitbucket authentication", "request is anonymous, check the token or password")
+	}
+
+	checkVersion(d, "bitbucket version", props.Version, MinBitbucketVersion)
+
+	for _, key := range projectKeys {
+		name := "bitbucket project admin " + key
+		_, err := b.do(key, "", http.MethodGet, projectPath(key)+"/permissions/users", url.Values{"limit": {"1"}}, nil, nil)
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			d.pass(name, "project admin permission granted")
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			d.fail(name, "project not found")
+		case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+			d.fail(name, "project admin permission required")
+		default:
+			d.fail(name, "%v", err)
+		}
+	}
+}
+
+func (d *doctor) gitea(ctx context.Context, logger *slog.Logger) {
+	g, err := NewGitea(ctx, logger)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			d.connection("gitea", err)
+		} else {
+			d.fail("gitea config", "%v", err)
+		}
+		return
+	}
+	d.pass("gitea reachable", "%s", g.server)
+	d.tls("gitea", strings.HasPrefix(g.server, "https://"))
+
+	v, _, err := g.client.ServerVersion()
+	if err != nil {
+		d.fail("gitea version", "%v", err)
+	} else {
+		checkVersion(d, "gitea version", v, MinGiteaVersion)
+	}
+
+	user, _, err := g.client.GetMyUserInfo()
+	if err != nil {
+		d.fail("gitea authentication", "%v", err)
+		return
+	}
+	d.pass("gitea authentication", "authenticated as %s", user.UserName)
+
+	if user.IsAdmin {
+		d.pass("gitea admin", "%s is site admin", user.UserName)
+	} else {
+		d.fail("gitea admin", "%s is not site admin, required for creating users", user.UserName)
+	}
+
+	// only read requests, the read scope is granted by the read or the
+	// write scope of the category
+	scopes := []struct {
+		scope string
+		path  string
+	}{
+		{"admin", "/admin/users?limit=1"},
+		{"organization", "/user/orgs?limit=1"},
+		{"repository", "/user/repos?limit=1"},
+	}
+	for _, s := range scopes {
+		name := "gitea token scope " + s.scope
+		resp, err := g.do(http.MethodGet, s.path, nil, nil)
+		switch {
+		case err == nil:
+			d.pass(name, "read granted")
+		case resp != nil && resp.StatusCode == http.StatusForbidden:
+			d.fail(name, "token scope missing")
+		default:
+			d.fail(name, "%v", err)
+		}
+	}
+	d.warn("gitea token write scopes", "can't be checked without changes, the token needs write:admin, write:organization and write:repository")
+
+	d.authSource(g)
+}
+
+// authSource check the auth source exists by finding a user of it,
+// since gitea doesn't provide an API to list the auth sources.
+func (d *doctor) authSource(g *gitea) {
+	if g.sourceID == 0 {
+		d.pass("gitea auth source", "local accounts are created")
+		return
+	}
+
+	for page := 1; ; page++ {
+		users, _, err := g.client.AdminListUsers(gsdk.AdminListUsersOptions{
+			ListOptions: gsdk.ListOptions{Page: page, PageSize: 50},
+		})
+		if err != nil {
+			d.fail("gitea auth source", "%v", err)
+			return
+		}
+		for _, u := range users {
+			if u.SourceID == g.sourceID {
+				d.pass("gitea auth source", "source %d is used by %s", g.sourceID, u.UserName)
+				return
+			}
+		}
+		if len(users) < 50 {
+			break
+		}
+	}
+
+	d.warn("gitea auth source", "no user found with source %d, make sure the auth source exists", g.sourceID)
+}
+
+func checkVersion(d *doctor, name, current, minimum string) {
+	v, err := version.NewVersion(current)
+	if err != nil {
+		d.warn(name, "unknown version %q", current)
+		return
+	}
+
+	if v.LessThan(version.Must(version.NewVersion(minimum))) {
+		d.fail(name, "%s is not supported, requires %s or later", current, minimum)
+		return
+	}
+
+	d.pass(name, "%s", current)
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		verification     *tls.CertificateVerificationError
+		record           tls.RecordHeaderError
+	)
+
+	return errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid) ||
+		errors.As(err, &verification) ||
+		errors.As(err, &record)
+}
@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sortForks order the migrations so that the parent of a fork is migrated
+// before the fork. The manifest order is kept otherwise. A fork whose
+// parent isn't planned keeps its place, forks can't form a cycle.
+func sortForks(entries []ManifestEntry) ([]ManifestEntry, error) {
+	index := map[string]int{}
+	for i, e := range entries {
+		index[e.Source()] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	sorted := make([]ManifestEntry, 0, len(entries))
+	state := make([]int, len(entries))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		path = append(path, entries[i].Source())
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("fork cycle %s", strings.Join(path, " -> "))
+		}
+		state[i] = visiting
+		if parent, ok := index[entries[i].Origin]; ok {
+			if err := visit(parent, path); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		sorted = append(sorted, entries[i])
+		return nil
+	}
+	for i := range entries {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// forkNewRepo create the gitea repository as a fork of the migrated parent,
+// then push the branches and tags of the bitbucket fork into it. Gitea
+// allows a single fork of a repository per owner, so the fork falls back
+// to an independent repository if it can't be created.
+func (m *migration) forkNewRepo(ctx context.Context, opts MigrateNewRepoOption) error {
+	logger := m.repoLogger(opts)
+	logger.Info("create fork", "parent", opts.ForkOf.Target())
+
+	repo, err := m.Gitea.CreateFork(opts.ForkOf.TargetOwner, opts.ForkOf.TargetName, opts.Owner, opts.Name)
+	if err != nil {
+		logger.Warn("create fork failed, migrate as independent repository",
+			"parent", opts.ForkOf.Target(),
+			"error", err,
+		)
+		return m.transferNewRepo(ctx, opts)
+	}
+
+	_, err = m.Gitea.EditRepo(opts.Owner, opts.Name, EditRepoOption{
+		Description: &opts.Description,
+		Private:     &opts.Private,
+	})
+	if err == nil {
+		err = m.pushRepoContent(ctx, opts, repo)
+	}
+	if err != nil {
+		logger.Warn("delete repository of failed migration")
+		if derr := m.Gitea.DeleteRepo(opts.Owner, opts.Name); derr != nil {
+			return errors.Join(err, fmt.Errorf("delete repository: %w", derr))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,98 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortForks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []ManifestEntry
+		want    []string
+	}{
+		{
+			name: "no forks",
+			entries: []ManifestEntry{
+				{ProjectKey: "AIA", RepoSlug: "b"},
+				{ProjectKey: "AIA", RepoSlug: "a"},
+			},
+			want: []string{"AIA/b", "AIA/a"},
+		},
+		{
+			name: "parent after fork",
+			entries: []ManifestEntry{
+				{ProjectKey: "~JOHN", RepoSlug: "app", Origin: "AIA/app"},
+				{ProjectKey: "AIA", RepoSlug: "other"},
+				{ProjectKey: "AIA", RepoSlug: "app"},
+			},
+			want: []string{"AIA/app", "~JOHN/app", "AIA/other"},
+		},
+		{
+			name: "fork of a fork",
+			entries: []ManifestEntry{
+				{ProjectKey: "~JANE", RepoSlug: "app", Origin: "~JOHN/app"},
+				{ProjectKey: "~JOHN", RepoSlug: "app", Origin: "AIA/app"},
+				{ProjectKey: "AIA", RepoSlug: "app"},
+			},
+			want: []string{"AIA/app", "~JOHN/app", "~JANE/app"},
+		},
+		{
+			name: "parent not planned",
+			entries: []ManifestEntry{
+				{ProjectKey: "AIA", RepoSlug: "b"},
+				{ProjectKey: "~JOHN", RepoSlug: "app", Origin: "AIA/app"},
+				{ProjectKey: "AIA", RepoSlug: "a"},
+			},
+			want: []string{"AIA/b", "~JOHN/app", "AIA/a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortForks(tt.entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, e := range sorted {
+				got = append(got, e.Source())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortForksCycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []ManifestEntry
+		err     string
+	}{
+		{
+			name: "fork of itself",
+			entries: []ManifestEntry{
+				{ProjectKey: "AIA", RepoSlug: "app", Origin: "AIA/app"},
+			},
+			err: "fork cycle AIA/app -> AIA/app",
+		},
+		{
+			name: "forks of each other",
+			entries: []ManifestEntry{
+				{ProjectKey: "AIA", RepoSlug: "other"},
+				{ProjectKey: "AIA", RepoSlug: "app", Origin: "~JOHN/app"},
+				{ProjectKey: "~JOHN", RepoSlug: "app", Origin: "AIA/app"},
+			},
+			err: "fork cycle AIA/app -> ~JOHN/app -> AIA/app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sortForks(tt.entries)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
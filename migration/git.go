@@ -0,0 +1,268 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GitRemote git remote with credentials
+type GitRemote struct {
+	URL      string
+	Username string
+	Password string
+	SSHKey   string
+	LFSURL   string
+	TLS      TLSOption
+}
+
+// env get git environment variables for the remote.
+// credentials are passed by config environment variables instead of
+// command arguments, so they don't show up in the process list.
+func (r GitRemote) env() []string {
+	configs := [][2]string{}
+	if r.Username != "" || r.Password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(r.Username + ":" + r.Password))
+		configs = append(configs, [2]string{"http.extraHeader", "Authorization: Basic " + auth})
+	}
+	if r.LFSURL != "" {
+		configs = append(configs, [2]string{"lfs.url", r.LFSURL})
+	}
+	if r.TLS.SkipVerify {
+		configs = append(configs, [2]string{"http.sslVerify", "false"})
+	}
+	if r.TLS.CAFile != "" {
+		configs = append(configs, [2]string{"http.sslCAInfo", r.TLS.CAFile})
+	}
+	if r.TLS.CertFile != "" && r.TLS.KeyFile != "" {
+		configs = append(configs,
+			[2]string{"http.sslCert", r.TLS.CertFile},
+			[2]string{"http.sslKey", r.TLS.KeyFile},
+		)
+	}
+
+	env := []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=" + strconv.Itoa(len(configs)),
+	}
+	for i, c := range configs {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, c[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, c[1]),
+		)
+	}
+	if r.SSHKey != "" {
+		// git runs the command with the shell
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+shellQuote(r.SSHKey)+" -o IdentitiesOnly=yes")
+	}
+
+	return env
+}
+
+// shellQuote quote the value as a single shell word
+func shellQuote(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// git run the git command for the remote in the directory
+func git(ctx context.Context, logger *slog.Logger, dir string, remote GitRemote, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), remote.env()...)
+
+	progress := &progressWriter{logger: logger, step: args[0], view: progressFrom(ctx)}
+	cmd.Stderr = progress
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, progress.lastLines())
+	}
+
+	return nil
+}
+
+// cloneMirror mirror clone the source repository into a new folder
+// in the workspace. The caller is responsible for removing the folder.
+func cloneMirror(ctx context.Context, logger *slog.Logger, workspace string, source GitRemote) (string, error) {
+	return clone(ctx, logger, workspace, source)
+}
+
+// cloneMetadata mirror clone only the commits and tags without the trees and
+// blobs, enough for reading the history. Servers without partial clone
+// support send the full repository.
+func cloneMetadata(ctx context.Context, logger *slog.Logger, workspace string, source GitRemote) (string, error) {
+	return clone(ctx, logger, workspace, source, "--filter=tree:0")
+}
+
+// clonePointers mirror clone without the blobs of 1 KiB or larger, enough
+// for reading the git lfs pointers. Servers without partial clone support
+// send the full repository.
+func clonePointers(ctx context.Context, logger *slog.Logger, workspace string, source GitRemote) (string, error) {
+	return clone(ctx, logger, workspace, source, "--filter=blob:limit=1k")
+}
+
+func clone(ctx context.Context, logger *slog.Logger, workspace string, source GitRemote, extra ...string) (string, error) {
+	if err := os.MkdirAll(workspace, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp(workspace, "transfer-*.git")
+	if err != nil {
+		return "", err
+	}
+
+	logger.Info("start clone repository", "source", redactURL(source.URL))
+	args := append([]string{"clone", "--mirror", "--progress"}, extra...)
+	if err := git(ctx, logger, workspace, source, append(args, source.URL, dir)...); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// pushMirror push all branches and tags to the destination repository.
+// bitbucket internal refs like refs/pull-requests/* are rejected by gitea.
+func pushMirror(ctx context.Context, logger *slog.Logger, dir string, destination GitRemote) error {
+	logger.Info("start push repository", "destination", redactURL(destination.URL))
+	return git(ctx, logger, dir, destination,
+		"push", "--progress", destination.URL,
+		"+refs/heads/*:refs/heads/*",
+		"+refs/tags/*:refs/tags/*",
+	)
+}
+
+// lsRefs list the branches and tags of the remote repository by name
+func lsRefs(ctx context.Context, remote GitRemote) (map[string]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", remote.URL)
+	cmd.Env = append(os.Environ(), remote.env()...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	refs := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		oid, ref, ok := strings.Cut(line, "\t")
+		// skip the peeled annotated tags
+		if !ok || strings.HasSuffix(ref, "^{}") {
+			continue
+		}
+		refs[ref] = oid
+	}
+
+	return refs, nil
+}
+
+// redactURL mask the password in URL
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return v
+	}
+	return u.Redacted()
+}
+
+var progressPattern = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+):\s+(\d+)%`)
+
+// transferPattern final progress line of the git and git-lfs transfers
+var transferPattern = regexp.MustCompile(`^(Receiving objects|Writing objects|Downloading LFS objects|Uploading LFS objects): +100% \(\d+/\d+\), ([\d.]+) (bytes|B|KiB|MiB|GiB|KB|MB|GB) .*, done\.$`)
+
+// transferUnits git reports binary units, git-lfs decimal units
+var transferUnits = map[string]float64{
+	"bytes": 1, "B": 1,
+	"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30,
+	"KB": 1e3, "MB": 1e6, "GB": 1e9,
+}
+
+// parseTransfer get the direction and the bytes of the final transfer line
+func parseTransfer(line string) (direction string, bytes float64, ok bool) {
+	match := transferPattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", 0, false
+	}
+	value, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	direction = "received"
+	if match[1] == "Writing objects" || match[1] == "Uploading LFS objects" {
+		direction = "sent"
+	}
+	return direction, value * transferUnits[match[3]], true
+}
+
+// progressWriter log the git progress output
+type progressWriter struct {
+	logger  *slog.Logger
+	step    string
+	view    *progress
+	buf     bytes.Buffer
+	lines   []string
+	phase   string
+	percent int
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		data := w.buf.Bytes()
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(data[:i]))
+		w.buf.Next(i + 1)
+		if line != "" {
+			w.handle(line)
+		}
+	}
+
+	return len(p), nil
+}
+
+// handle log each phase at every 25 percent
+func (w *progressWriter) handle(line string) {
+	match := progressPattern.FindStringSubmatch(line)
+	if match == nil {
+		w.lines = append(w.lines, line)
+		if len(w.lines) > 5 {
+			w.lines = w.lines[1:]
+		}
+		w.logger.Debug("git output", "step", w.step, "line", line)
+		return
+	}
+
+	if direction, bytes, ok := parseTransfer(line); ok {
+		transferredBytes.WithLabelValues(direction).Add(bytes)
+	}
+
+	percent, _ := strconv.Atoi(match[2])
+	if match[1] != w.phase {
+		w.phase = match[1]
+		w.percent = -1
+	}
+	w.view.Transfer(w.phase, percent)
+	if percent != w.percent && (percent == 100 || percent-w.percent >= 25) {
+		w.percent = percent
+		w.logger.Info("git progress", "step", w.step, "phase", w.phase, "percent", percent)
+	}
+}
+
+func (w *progressWriter) lastLines() string {
+	lines := w.lines
+	if rest := strings.TrimSpace(w.buf.String()); rest != "" {
+		lines = append(lines, rest)
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,149 @@
+package migration
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit run the git command in the directory and fail the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestPushMirrorBareRepositories(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	source := filepath.Join(root, "source.git")
+	destination := filepath.Join(root, "destination.git")
+	work := filepath.Join(root, "work")
+	runGit(t, root, "init", "--bare", source)
+	runGit(t, root, "init", "--bare", destination)
+
+	// a branch, a tag and a bitbucket internal ref in the source repository
+	runGit(t, root, "init", work)
+	if err := os.WriteFile(filepath.Join(work, "README.md"), []byte("test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, work, "add", "README.md")
+	runGit(t, work, "commit", "-m", "initial commit")
+	runGit(t, work, "branch", "-M", "main")
+	runGit(t, work, "branch", "feature")
+	runGit(t, work, "tag", "v1.0.0")
+	runGit(t, work, "push", source, "main", "feature", "v1.0.0", "HEAD:refs/pull-requests/1/from")
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir, err := cloneMirror(ctx, logger, filepath.Join(root, "workspace"), GitRemote{URL: source})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := pushMirror(ctx, logger, dir, GitRemote{URL: destination}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := runGit(t, source, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	got := runGit(t, destination, "for-each-ref", "--format=%(objectname) %(refname)")
+	if got != want {
+		t.Errorf("destination refs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCloneMirrorInvalidSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	workspace := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := cloneMirror(context.Background(), logger, workspace, GitRemote{URL: filepath.Join(workspace, "missing.git")})
+	if err == nil {
+		t.Fatal("expected clone error")
+	}
+
+	// the failed clone must not leave a folder behind
+	entries, err := os.ReadDir(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("workspace not empty: %v", entries)
+	}
+}
+
+func TestGitRemoteSSHKey(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not installed")
+	}
+
+	tests := []string{
+		"/home/user/.ssh/id_ed25519",
+		"/home/user/my keys/id_rsa",
+		"/tmp/key's $(touch pwned) `id`;&|",
+	}
+	for _, key := range tests {
+		var command string
+		for _, e := range (GitRemote{SSHKey: key}).env() {
+			if v, ok := strings.CutPrefix(e, "GIT_SSH_COMMAND="); ok {
+				command = v
+			}
+		}
+
+		// git passes the command to the shell, print the words it gets
+		words, err := exec.Command("sh", "-c", "printf '%s\\n' "+command).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "ssh\n-i\n" + key + "\n-o\nIdentitiesOnly=yes\n"
+		if string(words) != want {
+			t.Errorf("ssh key %q: command words %q, want %q", key, words, want)
+		}
+	}
+}
+
+func TestParseTransfer(t *testing.T) {
+	tests := []struct {
+		line      string
+		direction string
+		bytes     float64
+		ok        bool
+	}{
+		{"Writing objects: 100% (3/3), 293.23 KiB | 19.55 MiB/s, done.", "sent", 293.23 * 1024, true},
+		{"Receiving objects: 100% (3/3), 225 bytes | 225.00 KiB/s, done.", "received", 225, true},
+		{"Receiving objects: 100% (1200/1200), 1.50 GiB | 80.00 MiB/s, done.", "received", 1.5 * (1 << 30), true},
+		{"Uploading LFS objects: 100% (2/2), 12 MB | 1.2 MB/s, done.", "sent", 12e6, true},
+		{"Downloading LFS objects: 100% (1/1), 512 B | 0 B/s, done.", "received", 512, true},
+		// progress before the end and lines without size aren't counted
+		{"Writing objects: 100% (3/3), 293.23 KiB | 19.55 MiB/s", "", 0, false},
+		{"Writing objects:  50% (3/6), 100.00 KiB | 1.00 MiB/s", "", 0, false},
+		{"Receiving objects: 100% (3/3), done.", "", 0, false},
+		{"remote: Compressing objects: 100% (2/2), done.", "", 0, false},
+	}
+	for _, tt := range tests {
+		direction, bytes, ok := parseTransfer(tt.line)
+		if direction != tt.direction || bytes != tt.bytes || ok != tt.ok {
+			t.Errorf("parseTransfer(%q) = %q, %v, %v, want %q, %v, %v", tt.line, direction, bytes, ok, tt.direction, tt.bytes, tt.ok)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package migration
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 
 	gsdk "code.gitea.io/sdk/gitea"
@@ -14,16 +18,22 @@ import (
 
 // NewGitea creates a new instance of the gitea struct.
 func NewGitea(ctx context.Context, logger *slog.Logger) (*gitea, error) {
+	token, err := resolveSecret(ctx, "gitea.token")
+	if err != nil {
+		return nil, err
+	}
+
 	g := &gitea{
-		ctx:        ctx,
-		server:     viper.GetString("gitea.server"),
-		token:      viper.GetString("gitea.token"),
-		skipVerify: viper.GetBool("gitea.skip-verify"),
-		sourceID:   viper.GetInt64("gitea.source-id"),
-		logger:     logger,
+		// not canceled by the run timeout, like the bitbucket client
+		ctx:      context.WithoutCancel(ctx),
+		server:   viper.GetString("gitea.server"),
+		token:    token,
+		sourceID: viper.GetInt64("gitea.source-id"),
+		limiter:  newRateLimiter("gitea"),
+		logger:   logger,
 	}
 
-	err := g.init()
+	err = g.init()
 	if err != nil {
 		return nil, err
 	}
@@ -36,9 +46,11 @@ type gitea struct {
 	ctx        context.Context
 	server     string
 	token      string
-	skipVerify bool
 	sourceID   int64
 	client     *gsdk.Client
+	clientOpts []gsdk.ClientOption
+	httpClient *http.Client
+	limiter    *rateLimiter
 	logger     *slog.Logger
 }
 
@@ -50,21 +62,18 @@ func (g *gitea) init() error {
 
 	g.server = strings.TrimRight(g.server, "/")
 
-	opts := []gsdk.ClientOption{
-		gsdk.SetToken(g.token),
+	httpClient, err := newHTTPClient("gitea", g.logger, g.limiter)
+	if err != nil {
+		return fmt.Errorf("gitea http client: %w", err)
 	}
 
-	if g.skipVerify {
-		// add new http client for skip verify
-		httpClient := &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-		}
-		opts = append(opts, gsdk.SetHTTPClient(httpClient))
+	g.clientOpts = []gsdk.ClientOption{
+		gsdk.SetToken(g.token),
+		gsdk.SetHTTPClient(httpClient),
 	}
+	g.httpClient = httpClient
 
-	client, err := gsdk.NewClient(g.server, opts...)
+	client, err := gsdk.NewClient(g.server, g.clientOpts...)
 	if err != nil {
 		return err
 	}
@@ -73,6 +82,52 @@ func (g *gitea) init() error {
 	return nil
 }
 
+// newClient creates a gitea client bound to the context.
+func (g *gitea) newClient(ctx context.Context) (*gsdk.Client, error) {
+	return gsdk.NewClient(g.server, append(g.clientOpts, gsdk.SetContext(ctx))...)
+}
+
+// do send the request to the gitea API for endpoints which are not
+// supported by the gitea sdk. The path is relative to /api/v1, and the
+// JSON response is decoded into out if it isn't nil.
+func (g *gitea) do(method, path string, body, out interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(g.ctx, method, g.server+"/api/v1"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "token "+g.token)
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp, fmt.Errorf("gitea api status: %d, body: %s", resp.StatusCode, data)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
 // CreateOrgOption create organization option
 type CreateOrgOption struct {
 	Name        string
@@ -110,20 +165,52 @@ type MigrateRepoOption struct {
 	CloneAddr    string
 	Private      bool
 	Description  string
+	Mirror       bool
 	AuthUsername string
 	AuthPassword string
+	LFS          bool
+	LFSEndpoint  string
 }
 
-// MigrateRepo migrate repository
-func (g *gitea) MigrateRepo(opts MigrateRepoOption) (*gsdk.Repository, error) {
-	newRepo, _, err := g.client.MigrateRepo(gsdk.MigrateRepoOption{
+func (opts MigrateRepoOption) sdkOption() gsdk.MigrateRepoOption {
+	return gsdk.MigrateRepoOption{
 		RepoName:     opts.RepoName,
 		RepoOwner:    opts.RepoOwner,
 		CloneAddr:    opts.CloneAddr,
 		Private:      opts.Private,
 		Description:  opts.Description,
+		Mirror:       opts.Mirror,
 		AuthUsername: opts.AuthUsername,
 		AuthPassword: opts.AuthPassword,
+		LFS:          opts.LFS,
+		LFSEndpoint:  opts.LFSEndpoint,
+	}
+}
+
+// MigrateRepo migrate repository
+func (g *gitea) MigrateRepo(opts MigrateRepoOption) (*gsdk.Repository, error) {
+	newRepo, _, err := g.client.MigrateRepo(opts.sdkOption())
+	if err != nil {
+		return nil, err
+	}
+
+	return newRepo, nil
+}
+
+// CreateRepoOption create repository option
+type CreateRepoOption struct {
+	RepoName    string
+	RepoOwner   string
+	Private     bool
+	Description string
+}
+
+// CreateRepo create an empty repository in organization
+func (g *gitea) CreateRepo(opts CreateRepoOption) (*gsdk.Repository, error) {
+	newRepo, _, err := g.client.CreateOrgRepo(opts.RepoOwner, gsdk.CreateRepoOption{
+		Name:        opts.RepoName,
+		Private:     opts.Private,
+		Description: opts.Description,
 	})
 	if err != nil {
 		return nil, err
@@ -132,6 +219,94 @@ func (g *gitea) MigrateRepo(opts MigrateRepoOption) (*gsdk.Repository, error) {
 	return newRepo, nil
 }
 
+// PushRemote get the git remote for pushing to the repository
+func (g *gitea) PushRemote(repo *gsdk.Repository) GitRemote {
+	return GitRemote{
+		URL:      repo.CloneURL,
+		Username: g.token,
+		Password: "x-oauth-basic",
+		TLS:      loadTLSOption("gitea"),
+	}
+}
+
+// OwnerURL get the web page of the user or organization
+func (g *gitea) OwnerURL(owner string) string {
+	return g.server + "/" + url.PathEscape(owner)
+}
+
+// GetRepo get repository, returns nil if the repository doesn't exist
+func (g *gitea) GetRepo(owner, name string) (*gsdk.Repository, error) {
+	repo, resp, err := g.client.GetRepo(owner, name)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// CreateFork fork the repository into the organization with the new name
+func (g *gitea) CreateFork(owner, name, org, newName string) (*gsdk.Repository, error) {
+	repo, _, err := g.client.CreateFork(owner, name, gsdk.CreateForkOption{
+		Organization: &org,
+		Name:         &newName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// EditRepoOption edit repository option
+type EditRepoOption struct {
+	Description                   *string
+	Private                       *bool
+	Archived                      *bool
+	DefaultBranch                 *string
+	AllowMerge                    *bool
+	AllowFastForwardOnly          *bool
+	AllowSquash                   *bool
+	AllowRebase                   *bool
+	AllowRebaseMerge              *bool
+	DefaultMergeStyle             *gsdk.MergeStyle
+	DefaultDeleteBranchAfterMerge *bool
+	HasIssues                     *bool
+	ExternalTracker               *gsdk.ExternalTracker
+}
+
+// EditRepo update the repository metadata, nil values are unchanged
+func (g *gitea) EditRepo(owner, name string, opts EditRepoOption) (*gsdk.Repository, error) {
+	repo, _, err := g.client.EditRepo(owner, name, gsdk.EditRepoOption{
+		Description:                   opts.Description,
+		Private:                       opts.Private,
+		Archived:                      opts.Archived,
+		DefaultBranch:                 opts.DefaultBranch,
+		AllowMerge:                    opts.AllowMerge,
+		AllowFastForwardOnlyMerge:     opts.AllowFastForwardOnly,
+		AllowSquash:                   opts.AllowSquash,
+		AllowRebase:                   opts.AllowRebase,
+		AllowRebaseMerge:              opts.AllowRebaseMerge,
+		DefaultMergeStyle:             opts.DefaultMergeStyle,
+		DefaultDeleteBranchAfterMerge: opts.DefaultDeleteBranchAfterMerge,
+		HasIssues:                     opts.HasIssues,
+		ExternalTracker:               opts.ExternalTracker,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// DeleteRepo delete repository
+func (g *gitea) DeleteRepo(owner, name string) error {
+	_, err := g.client.DeleteRepo(owner, name)
+	return err
+}
+
 type CreateUserOption struct {
 	SourceID  int64
 	LoginName string
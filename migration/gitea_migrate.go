@@ -0,0 +1,150 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	gsdk "code.gitea.io/sdk/gitea"
+)
+
+// WaitMigrateRepo start the gitea migration and wait until it is done.
+//
+// The migrate request runs in the background while the repository is
+// polled for progress. If the request is cut off by a proxy or the
+// per-request timeout, gitea keeps migrating. The gitea API doesn't expose
+// the migration status, so the repository is polled until it has all
+// branches and tags of the source, gitea removes it if the migration
+// fails. The repository is deleted if the migration fails or times out,
+// unless it existed before.
+func (g *gitea) WaitMigrateRepo(ctx context.Context, opts MigrateRepoOption, source GitRemote, interval time.Duration) (*gsdk.Repository, error) {
+	logger := g.logger.With("owner", opts.RepoOwner, "name", opts.RepoName)
+
+	existing, err := g.GetRepo(opts.RepoOwner, opts.RepoName)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := g.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		repo *gsdk.Repository
+		resp *gsdk.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		repo, resp, err := client.MigrateRepo(opts.sdkOption())
+		done <- result{repo: repo, resp: resp, err: err}
+	}()
+
+	cleanup := func(cause error) error {
+		if existing != nil {
+			return cause
+		}
+		repo, err := g.GetRepo(opts.RepoOwner, opts.RepoName)
+		if err != nil || repo == nil {
+			return cause
+		}
+		logger.Warn("delete repository of failed migration")
+		if err := g.DeleteRepo(opts.RepoOwner, opts.RepoName); err != nil {
+			return errors.Join(cause, fmt.Errorf("delete repository: %w", err))
+		}
+		return cause
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	lost := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, cleanup(fmt.Errorf("migration timeout: %w", ctx.Err()))
+		case r := <-done:
+			if r.err == nil {
+				return r.repo, nil
+			}
+			if ctx.Err() != nil || !isRequestLost(r.resp, r.err) {
+				return nil, cleanup(r.err)
+			}
+			logger.Warn("migration request lost, wait for gitea to finish", "error", r.err)
+			lost = true
+			// stop receiving from the finished request
+			done = nil
+		case <-ticker.C:
+			repo, err := g.GetRepo(opts.RepoOwner, opts.RepoName)
+			if err != nil {
+				logger.Debug("get repository status failed", "error", err)
+				continue
+			}
+			if repo == nil {
+				if lost {
+					return nil, errors.New("migration failed on gitea, repository was removed")
+				}
+				logger.Info("migration queued", "elapsed", time.Since(start).Round(time.Second))
+				continue
+			}
+
+			logger.Info("migration in progress",
+				"elapsed", time.Since(start).Round(time.Second),
+				"size_kb", repo.Size,
+			)
+			if !lost {
+				continue
+			}
+			complete, err := g.hasRefs(ctx, repo, source)
+			if err != nil {
+				logger.Debug("compare repository refs failed", "error", err)
+				continue
+			}
+			if complete {
+				return repo, nil
+			}
+		}
+	}
+}
+
+// hasRefs check the gitea repository has all branches and tags of the
+// source repository with the same commits.
+func (g *gitea) hasRefs(ctx context.Context, repo *gsdk.Repository, source GitRemote) (bool, error) {
+	want, err := lsRefs(ctx, source)
+	if err != nil {
+		return false, err
+	}
+	got, err := lsRefs(ctx, g.PushRemote(repo))
+	if err != nil {
+		return false, err
+	}
+
+	for ref, oid := range want {
+		if got[ref] != oid {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// isRequestLost check the migrate request failed without a gitea response,
+// by network errors or gateway timeouts.
+func isRequestLost(resp *gsdk.Response, err error) bool {
+	if resp == nil || resp.Response == nil {
+		var urlErr *url.Error
+		return errors.As(err, &urlErr)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
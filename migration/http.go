@@ -0,0 +1,52 @@
+package migration
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// newHTTPClient creates the http client for the server config prefix
+func newHTTPClient(prefix string, logger *slog.Logger, limiter *rateLimiter) (*http.Client, error) {
+	tlsConfig, err := loadTLSOption(prefix).Config()
+	if err != nil {
+		return nil, err
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = tlsConfig
+	base.Proxy = proxyFunc()
+
+	return &http.Client{
+		Transport: &transport{
+			base:    base,
+			opts:    loadTransportOption(),
+			limiter: limiter,
+			server:  prefix,
+			logger:  logger,
+		},
+	}, nil
+}
+
+// proxyFunc get the proxy from config, fall back to the environment variables.
+// http, https and socks5 proxy URLs are supported.
+func proxyFunc() func(*http.Request) (*url.URL, error) {
+	proxy := viper.GetString("http.proxy")
+	if proxy == "" {
+		return http.ProxyFromEnvironment
+	}
+
+	cfg := &httpproxy.Config{
+		HTTPProxy:  proxy,
+		HTTPSProxy: proxy,
+		NoProxy:    viper.GetString("http.no-proxy"),
+	}
+	fn := cfg.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return fn(req.URL)
+	}
+}
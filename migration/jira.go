@@ -0,0 +1,180 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	gsdk "code.gitea.io/sdk/gitea"
+)
+
+// JiraOption configure jira as the external issue tracker of the repositories
+type JiraOption struct {
+	Enabled bool
+	// URL jira base URL, detected from the bitbucket application links if empty
+	URL string
+	// Projects jira project key by bitbucket "project" or "project/repo",
+	// read from the jira integration if missing
+	Projects map[string]string
+}
+
+// jiraIssuePattern jira issue key like ABC-123
+var jiraIssuePattern = regexp.MustCompile(`\b([A-Z][A-Z0-9_]+)-[1-9][0-9]*\b`)
+
+// JiraURL get the URL of the jira application link, preferring the primary link
+func (b *bitbucket) JiraURL() (string, error) {
+	var result struct {
+		ApplicationLinks []struct {
+			TypeID     string `json:"typeId"`
+			DisplayURL string `json:"displayUrl"`
+			Primary    bool   `json:"primary"`
+		} `json:"applicationLinks"`
+	}
+	if _, err := b.do("", "", http.MethodGet, "/applinks/1.0/applicationlink", nil, nil, &result); err != nil {
+		return "", err
+	}
+
+	jiraURL := ""
+	for _, link := range result.ApplicationLinks {
+		if link.TypeID != "jira" {
+			continue
+		}
+		if jiraURL == "" || link.Primary {
+			jiraURL = link.DisplayURL
+		}
+	}
+	if jiraURL == "" {
+		return "", errors.New("no jira application link found, set jira.url")
+	}
+
+	return strings.TrimSuffix(jiraURL, "/"), nil
+}
+
+// JiraProject get the jira project linked to the bitbucket project by the
+// jira integration, returns empty if no project is linked.
+func (b *bitbucket) JiraProject(projectKey string) (string, error) {
+	var link struct {
+		Key string `json:"key"`
+	}
+	// the path is misspelled by the bitbucket API
+	_, err := b.do(projectKey, "", http.MethodGet, "/jira/1.0/projects/"+url.PathEscape(projectKey)+"/primary-enitity-link", nil, nil, &link)
+	var apiErr *APIError
+	// no link, or the jira integration isn't installed
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return link.Key, nil
+}
+
+// JiraIssueProjects count the jira project keys of the issue keys in the
+// messages of the recent commits
+func (b *bitbucket) JiraIssueProjects(projectKey, repoSlug string) (map[string]int, error) {
+	var page struct {
+		Values []struct {
+			Message string `json:"message"`
+		} `json:"values"`
+	}
+	counts := map[string]int{}
+	_, err := b.do(projectKey, repoSlug, http.MethodGet, repoPath(projectKey, repoSlug)+"/commits", url.Values{"limit": {"100"}}, nil, &page)
+	var apiErr *APIError
+	// empty repositories have no commits
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, commit := range page.Values {
+		for _, match := range jiraIssuePattern.FindAllStringSubmatch(commit.Message, -1) {
+			counts[match[1]]++
+		}
+	}
+
+	return counts, nil
+}
+
+// guessJiraProject get the project of the most issue keys, ok is false if
+// no project has the majority of the issue keys
+func guessJiraProject(counts map[string]int) (key string, ok bool) {
+	total := 0
+	for k, n := range counts {
+		total += n
+		if key == "" || n > counts[key] || n == counts[key] && k < key {
+			key = k
+		}
+	}
+	if counts[key]*2 <= total {
+		return "", false
+	}
+
+	return key, true
+}
+
+// errJiraAmbiguous the jira project can't be guessed from the commits
+var errJiraAmbiguous = errors.New("jira project ambiguous")
+
+// jiraProject get the jira project key of the repository from the config
+// or the jira integration of the bitbucket project. The issue keys in the
+// recent commits are the fallback.
+func (m *migration) jiraProject(opts MigrateNewRepoOption) (string, error) {
+	for _, key := range []string{opts.ProjectKey + "/" + opts.RepoSlug, opts.ProjectKey} {
+		if v, ok := m.jira.Projects[strings.ToLower(key)]; ok {
+			return v, nil
+		}
+	}
+
+	key, err := m.Bitbucket.JiraProject(opts.ProjectKey)
+	if err != nil || key != "" {
+		return key, err
+	}
+
+	counts, err := m.Bitbucket.JiraIssueProjects(opts.ProjectKey, opts.RepoSlug)
+	if err != nil || len(counts) == 0 {
+		return "", err
+	}
+	key, ok := guessJiraProject(counts)
+	if !ok {
+		return "", fmt.Errorf("%w, no project linked and the commits reference %v", errJiraAmbiguous, counts)
+	}
+	m.repoLogger(opts).Info("no jira project linked, guessed from the commits", "jira_project", key, "issue_projects", counts)
+
+	return key, nil
+}
+
+// migrateJira use jira as the external issue tracker, which replaces the
+// internal gitea issues. Issue keys like ABC-123 link to the jira issue.
+func (m *migration) migrateJira(opts MigrateNewRepoOption) error {
+	key, err := m.jiraProject(opts)
+	if errors.Is(err, errJiraAmbiguous) {
+		m.repoLogger(opts).Warn("skip jira issue tracker, set jira.projects", "error", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("detect jira project: %w", err)
+	}
+
+	trackerURL := m.jira.URL
+	if key != "" {
+		trackerURL = m.jira.URL + "/browse/" + key
+	}
+	m.repoLogger(opts).Info("set jira issue tracker", "jira_project", key, "url", trackerURL)
+
+	hasIssues := true
+	_, err = m.Gitea.EditRepo(opts.Owner, opts.Name, EditRepoOption{
+		HasIssues: &hasIssues,
+		ExternalTracker: &gsdk.ExternalTracker{
+			ExternalTrackerURL:    trackerURL,
+			ExternalTrackerFormat: m.jira.URL + "/browse/{index}",
+			ExternalTrackerStyle:  "alphanumeric",
+		},
+	})
+	return err
+}
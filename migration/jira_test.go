@@ -0,0 +1,26 @@
+package migration
+
+import "testing"
+
+func TestGuessJiraProject(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts map[string]int
+		key    string
+		ok     bool
+	}{
+		{"single project", map[string]int{"PAY": 3}, "PAY", true},
+		{"majority", map[string]int{"PAY": 3, "OPS": 1, "SEC": 1}, "PAY", true},
+		{"tie", map[string]int{"PAY": 2, "OPS": 2}, "", false},
+		{"no majority", map[string]int{"PAY": 2, "OPS": 1, "SEC": 1}, "", false},
+		{"no issue keys", map[string]int{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := guessJiraProject(tt.counts)
+			if key != tt.key || ok != tt.ok {
+				t.Errorf("guessJiraProject(%v) = %q, %v, want %q, %v", tt.counts, key, ok, tt.key, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LFSObject git lfs object pointer
+type LFSObject struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// lfsObjects list all unique lfs objects referenced in the repository.
+// Only the local blobs are read for the lfs pointers, so a clone without
+// the large blobs is enough.
+func lfsObjects(ctx context.Context, dir string) ([]LFSObject, error) {
+	out, err := gitOutput(ctx, dir, "cat-file", "--batch-all-objects", "--batch-check=%(objecttype) %(objectname) %(objectsize)")
+	if err != nil {
+		return nil, err
+	}
+
+	oids := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size < lfsPointerMaxSize {
+			oids = append(oids, fields[1])
+		}
+	}
+
+	seen := make(map[string]bool)
+	objects := []LFSObject{}
+	err = readBlobs(ctx, dir, oids, func(_ string, data []byte) {
+		o, ok := parseLFSPointer(data)
+		if !ok || seen[o.Oid] {
+			return
+		}
+		seen[o.Oid] = true
+		objects = append(objects, o)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// parseLFSPointer parse the oid and size of the git lfs pointer file
+func parseLFSPointer(data []byte) (LFSObject, bool) {
+	if !bytes.HasPrefix(data, []byte(lfsPointerPrefix)) {
+		return LFSObject{}, false
+	}
+
+	o := LFSObject{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			o.Oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			o.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+
+	return o, o.Oid != ""
+}
+
+// pushLFS fetch all lfs objects from the origin of the mirror
+// clone and upload them to the lfs store of the destination remote.
+func pushLFS(ctx context.Context, logger *slog.Logger, dir string, source, destination GitRemote) error {
+	logger.Info("start fetch lfs objects", "source", redactURL(source.URL))
+	if err := git(ctx, logger, dir, source, "lfs", "fetch", "--all", "origin"); err != nil {
+		return err
+	}
+
+	logger.Info("start push lfs objects", "destination", redactURL(destination.URL))
+	return git(ctx, logger, dir, destination, "lfs", "push", "--all", destination.URL)
+}
+
+// MissingLFSObjects check the objects exist in the gitea lfs store
+// with the batch API and returns the missing objects.
+func (g *gitea) MissingLFSObjects(cloneURL string, objects []LFSObject) ([]LFSObject, error) {
+	missing := []LFSObject{}
+	for start := 0; start < len(objects); start += 100 {
+		end := min(start+100, len(objects))
+		batch, err := g.lfsBatch(cloneURL, objects[start:end])
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, batch...)
+	}
+
+	return missing, nil
+}
+
+func (g *gitea) lfsBatch(cloneURL string, objects []LFSObject) ([]LFSObject, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   objects,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(cloneURL, "/") + "/info/lfs/objects/batch"
+	req, err := http.NewRequestWithContext(g.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	req.Header.Set("Authorization", "token "+g.token)
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lfs batch request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Objects []struct {
+			LFSObject
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	missing := []LFSObject{}
+	for _, o := range result.Objects {
+		if o.Error != nil {
+			missing = append(missing, o.LFSObject)
+		}
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,64 @@
+package migration
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLFSObjectsPointerClone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	source := filepath.Join(root, "source.git")
+	work := filepath.Join(root, "work")
+	runGit(t, root, "init", "--bare", source)
+	runGit(t, source, "config", "uploadpack.allowFilter", "true")
+
+	oid := strings.Repeat("ab", 32)
+	pointer := lfsPointerPrefix + "\noid sha256:" + oid + "\nsize 12345\n"
+	files := map[string]string{
+		"image.png":  pointer,
+		"copy.png":   pointer,
+		"README.md":  "not a pointer\n",
+		"large.data": strings.Repeat("x", 4096),
+	}
+	runGit(t, root, "init", work)
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(work, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-m", "initial commit")
+	runGit(t, work, "push", source, "HEAD:refs/heads/main")
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir, err := clonePointers(ctx, logger, filepath.Join(root, "workspace"), GitRemote{URL: "file://" + source})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the large blob isn't cloned, cat-file -e would fetch it from the promisor remote
+	large := strings.TrimSpace(runGit(t, work, "rev-parse", "HEAD:large.data"))
+	if local := runGit(t, dir, "cat-file", "--batch-all-objects", "--batch-check"); strings.Contains(local, large) {
+		t.Error("large blob cloned")
+	}
+
+	objects, err := lfsObjects(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Oid != oid || objects[0].Size != 12345 {
+		t.Errorf("lfs objects %+v, want oid %s with size 12345", objects, oid)
+	}
+}
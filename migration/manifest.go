@@ -0,0 +1,265 @@
+package migration
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Visibility repository visibility override
+type Visibility string
+
+const (
+	// VisibilitySource keep the visibility of the bitbucket repository
+	VisibilitySource Visibility = ""
+	// VisibilityPublic create a public gitea repository
+	VisibilityPublic Visibility = "public"
+	// VisibilityPrivate create a private gitea repository
+	VisibilityPrivate Visibility = "private"
+)
+
+// manifestColumns the keys of a manifest entry
+var manifestColumns = []string{"project", "repo", "target-owner", "target-name", "visibility", "mirror"}
+
+// ManifestEntry single migration of the manifest.
+// An empty repo migrates all repositories of the project.
+type ManifestEntry struct {
+	ProjectKey  string     `yaml:"project"`
+	RepoSlug    string     `yaml:"repo"`
+	TargetOwner string     `yaml:"target-owner"`
+	TargetName  string     `yaml:"target-name"`
+	Visibility  Visibility `yaml:"visibility"`
+	Mirror      bool       `yaml:"mirror"`
+	// Archived the bitbucket repository is archived, set by the plan
+	Archived bool `yaml:"-"`
+	// Origin the project/repo of the fork parent, set by the plan
+	Origin string `yaml:"-"`
+	// Line the line of the entry in the manifest file
+	Line int `yaml:"-"`
+}
+
+// UnmarshalYAML decode the entry, rejecting unknown keys
+func (e *ManifestEntry) UnmarshalYAML(node *yaml.Node) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !isManifestColumn(key.Value) {
+			return fmt.Errorf("line %d: unknown key %q", key.Line, key.Value)
+		}
+	}
+
+	type plain ManifestEntry
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+	e.Line = node.Line
+	return nil
+}
+
+// Source get the bitbucket project/repo of the entry
+func (e ManifestEntry) Source() string {
+	if e.RepoSlug == "" {
+		return e.ProjectKey
+	}
+	return e.ProjectKey + "/" + e.RepoSlug
+}
+
+// Target get the gitea owner/name of the entry
+func (e ManifestEntry) Target() string {
+	return e.TargetOwner + "/" + e.TargetName
+}
+
+// Private get the visibility of the gitea repository
+func (e ManifestEntry) Private(sourcePublic bool) bool {
+	switch e.Visibility {
+	case VisibilityPublic:
+		return false
+	case VisibilityPrivate:
+		return true
+	}
+	return !sourcePublic
+}
+
+// Validate check the values of the entry
+func (e ManifestEntry) Validate() error {
+	errs := []error{}
+	if e.ProjectKey == "" {
+		errs = append(errs, errors.New("project can't be empty"))
+	}
+	if e.RepoSlug == "" && e.TargetName != "" {
+		errs = append(errs, errors.New("target-name requires repo"))
+	}
+	switch e.Visibility {
+	case VisibilitySource, VisibilityPublic, VisibilityPrivate:
+	default:
+		errs = append(errs, fmt.Errorf("visibility %q invalid, must be %q or %q", e.Visibility, VisibilityPublic, VisibilityPrivate))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Manifest list of migrations
+type Manifest struct {
+	Repositories []ManifestEntry `yaml:"repositories"`
+}
+
+// Validate check the entries, a project or repository must be listed once
+func (m *Manifest) Validate() error {
+	errs := []error{}
+	sources := map[string]ManifestEntry{}
+	for _, e := range m.Repositories {
+		if err := e.Validate(); err != nil {
+			errs = append(errs, entryError(e, err))
+			continue
+		}
+		key := strings.ToLower(e.Source())
+		if prev, ok := sources[key]; ok {
+			err := errors.New("already listed")
+			if prev.Line > 0 {
+				err = fmt.Errorf("already listed on line %d", prev.Line)
+			}
+			errs = append(errs, entryError(e, err))
+			continue
+		}
+		sources[key] = e
+	}
+
+	return errors.Join(errs...)
+}
+
+// LoadManifest read the manifest from the yaml or csv file
+func LoadManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var manifest *Manifest
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		manifest, err = readYAMLManifest(f)
+	case ".csv":
+		manifest, err = readCSVManifest(f)
+	default:
+		return nil, fmt.Errorf("manifest %s: unsupported format, must be yaml or csv", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+
+	return manifest, nil
+}
+
+func readYAMLManifest(r io.Reader) (*Manifest, error) {
+	manifest := &Manifest{}
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(manifest); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// readCSVManifest read the csv manifest, the first row is the header with
+// the column names. Lines starting with # are ignored.
+func readCSVManifest(r io.Reader) (*Manifest, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	hasProject := false
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if !isManifestColumn(header[i]) {
+			return nil, fmt.Errorf("unknown column %q, must be one of %s", column, strings.Join(manifestColumns, ", "))
+		}
+		hasProject = hasProject || header[i] == "project"
+	}
+	if !hasProject {
+		return nil, errors.New("header misses the project column")
+	}
+
+	manifest := &Manifest{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		e := ManifestEntry{Line: line}
+		for i, value := range record {
+			if i >= len(header) {
+				return nil, fmt.Errorf("line %d: too many columns", line)
+			}
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "project":
+				e.ProjectKey = value
+			case "repo":
+				e.RepoSlug = value
+			case "target-owner":
+				e.TargetOwner = value
+			case "target-name":
+				e.TargetName = value
+			case "visibility":
+				e.Visibility = Visibility(strings.ToLower(value))
+			case "mirror":
+				if value == "" {
+					continue
+				}
+				e.Mirror, err = parseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: mirror %q invalid", line, value)
+				}
+			}
+		}
+		manifest.Repositories = append(manifest.Repositories, e)
+	}
+
+	return manifest, nil
+}
+
+// parseBool parse the bool value, also accepting yes and no
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y":
+		return true, nil
+	case "no", "n":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func isManifestColumn(name string) bool {
+	for _, c := range manifestColumns {
+		if name == c {
+			return true
+		}
+	}
+	return false
+}
+
+// entryError add the location of the entry to the error
+func entryError(e ManifestEntry, err error) error {
+	if e.Line > 0 {
+		return fmt.Errorf("line %d (%s): %w", e.Line, e.Source(), err)
+	}
+	return fmt.Errorf("%s: %w", e.Source(), err)
+}
@@ -0,0 +1,186 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeManifest write the manifest content into a temp file with the name
+func writeManifest(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		lines   []int
+	}{
+		{
+			name: "yaml",
+			file: "repos.yaml",
+			content: "repositories:\n" +
+				"  - {project: AIA, repo: test, target-owner: platform, target-name: test-service, visibility: private}\n" +
+				"  - {project: BIA, mirror: true}\n",
+			lines: []int{2, 3},
+		},
+		{
+			name: "csv",
+			file: "repos.csv",
+			content: "project,repo,target-owner,target-name,visibility,mirror\n" +
+				"AIA, test ,platform,test-service,Private,no\n" +
+				"BIA,,,,,yes\n",
+			lines: []int{2, 3},
+		},
+		{
+			name: "csv columns in any order with comments",
+			file: "repos.CSV",
+			content: "# migration of wave 1\n" +
+				"Mirror,Project,Repo,Target-Name,Visibility,Target-Owner\n" +
+				",AIA,test,test-service,private,platform\n" +
+				"true,BIA\n",
+			lines: []int{3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := LoadManifest(writeManifest(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []ManifestEntry{
+				{ProjectKey: "AIA", RepoSlug: "test", TargetOwner: "platform", TargetName: "test-service", Visibility: VisibilityPrivate, Line: tt.lines[0]},
+				{ProjectKey: "BIA", Mirror: true, Line: tt.lines[1]},
+			}
+			if got := manifest.Repositories; !reflect.DeepEqual(got, want) {
+				t.Errorf("entries:\n%+v\nwant:\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		err     string
+	}{
+		{
+			name:    "yaml unknown entry key",
+			file:    "repos.yaml",
+			content: "repositories:\n  - project: AIA\n    target: x\n",
+			err:     `line 3: unknown key "target"`,
+		},
+		{
+			name:    "yaml unknown top level key",
+			file:    "repos.yml",
+			content: "repos:\n  - project: AIA\n",
+			err:     "field repos not found",
+		},
+		{
+			name:    "csv unknown column",
+			file:    "repos.csv",
+			content: "project,repo,owner\nAIA,test,x\n",
+			err:     `unknown column "owner"`,
+		},
+		{
+			name:    "csv missing header",
+			file:    "repos.csv",
+			content: "",
+			err:     "read header",
+		},
+		{
+			name:    "csv header without project",
+			file:    "repos.csv",
+			content: "repo,target-name\ntest,x\n",
+			err:     "header misses the project column",
+		},
+		{
+			name:    "csv too many columns",
+			file:    "repos.csv",
+			content: "project,repo\nAIA,test,x\n",
+			err:     "line 2: too many columns",
+		},
+		{
+			name:    "csv invalid mirror",
+			file:    "repos.csv",
+			content: "project,mirror\nAIA,maybe\n",
+			err:     `line 2: mirror "maybe" invalid`,
+		},
+		{
+			name:    "unsupported format",
+			file:    "repos.json",
+			content: "{}",
+			err:     "unsupported format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadManifest(writeManifest(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestManifestEntryValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry ManifestEntry
+		err   string
+	}{
+		{"repository", ManifestEntry{ProjectKey: "AIA", RepoSlug: "test", TargetName: "x", Visibility: VisibilityPublic}, ""},
+		{"project", ManifestEntry{ProjectKey: "AIA", TargetOwner: "platform"}, ""},
+		{"missing project", ManifestEntry{RepoSlug: "test"}, "project can't be empty"},
+		{"target name without repo", ManifestEntry{ProjectKey: "AIA", TargetName: "x"}, "target-name requires repo"},
+		{"invalid visibility", ManifestEntry{ProjectKey: "AIA", Visibility: "internal"}, `visibility "internal" invalid`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	manifest := &Manifest{Repositories: []ManifestEntry{
+		{ProjectKey: "AIA", RepoSlug: "test", Line: 2},
+		{ProjectKey: "AIA", Line: 3},
+		{ProjectKey: "aia", RepoSlug: "TEST", Line: 4},
+		{RepoSlug: "other", Line: 5},
+		{ProjectKey: "AIA", Line: 6},
+	}}
+
+	err := manifest.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	want := []string{
+		"line 4 (aia/TEST): already listed on line 2",
+		"line 5 (/other): project can't be empty",
+		"line 6 (AIA): already listed on line 3",
+	}
+	if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,272 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	gsdk "code.gitea.io/sdk/gitea"
+)
+
+// bitbucket merge check hook keys, the plugin key and the module key
+const (
+	hookRequiredApprovers = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:requiredApproversMergeHook"
+	hookRequiredBuilds    = "com.atlassian.bitbucket.server.bitbucket-build:requiredBuildsMergeCheck"
+	hookNeedsWork         = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:needs-work-merge-check"
+	hookIncompleteTasks   = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:incomplete-tasks-merge-check"
+	hookAllApprovers      = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:all-approvers-merge-check"
+)
+
+// merge checks without gitea equivalent
+const (
+	checkAllApprovers   = "all reviewers approve"
+	checkIncompleteTask = "no incomplete tasks"
+)
+
+// protectionRule gitea branch protection rule matching all branches, as the
+// bitbucket merge checks apply to all pull requests
+const protectionRule = "*"
+
+// Hook bitbucket repository hook
+type Hook struct {
+	Details struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"details"`
+	Enabled bool `json:"enabled"`
+}
+
+// MergeChecks bitbucket merge checks of the repository, as gitea branch
+// protection requirements
+type MergeChecks struct {
+	RequiredApprovals int
+	StatusChecks      []string
+	BlockOnRejected   bool
+	DismissStale      bool
+	// Unsupported merge checks without gitea equivalent
+	Unsupported []string
+}
+
+// Empty check no requirement is set
+func (c MergeChecks) Empty() bool {
+	return c.RequiredApprovals == 0 && len(c.StatusChecks) == 0 && !c.BlockOnRejected && !c.DismissStale
+}
+
+// GetMergeCheckHooks get the enabled merge check hooks of the repository,
+// including the hooks inherited from the project.
+func (b *bitbucket) GetMergeCheckHooks(projectKey, repoSlug string) ([]Hook, error) {
+	hooks := []Hook{}
+	query := url.Values{"type": {"PRE_PULL_REQUEST_MERGE"}}
+	err := b.paged(projectKey, repoSlug, repoPath(projectKey, repoSlug)+"/settings/hooks", query, 0, func(values json.RawMessage) error {
+		var page []Hook
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, h := range page {
+			if h.Enabled {
+				hooks = append(hooks, h)
+			}
+		}
+		return nil
+	})
+
+	return hooks, err
+}
+
+// GetHookSettings get the settings of the repository hook
+func (b *bitbucket) GetHookSettings(projectKey, repoSlug, key string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	resp, err := b.do(projectKey, repoSlug, http.MethodGet,
+		repoPath(projectKey, repoSlug)+"/settings/hooks/"+url.PathEscape(key)+"/settings", nil, nil, &settings)
+	// hooks without settings return no content
+	if resp != nil && resp.StatusCode == http.StatusNoContent {
+		return settings, nil
+	}
+
+	return settings, err
+}
+
+// GetRequiredBuilds get the build keys required by the required builds
+// merge check, returns nothing if the server doesn't support it.
+func (b *bitbucket) GetRequiredBuilds(projectKey, repoSlug string) ([]string, error) {
+	path := "/required-builds/latest/projects/" + url.PathEscape(projectKey) + "/repos/" + url.PathEscape(repoSlug) + "/conditions"
+	keys := []string{}
+	err := b.paged(projectKey, repoSlug, path, nil, 0, func(values json.RawMessage) error {
+		var page []struct {
+			BuildParentKeys []string `json:"buildParentKeys"`
+		}
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, c := range page {
+			keys = append(keys, c.BuildParentKeys...)
+		}
+		return nil
+	})
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	return keys, err
+}
+
+// settingInt read the number setting, which can be a JSON number or string
+func settingInt(settings map[string]interface{}, key string) int {
+	switch v := settings[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// GetMergeChecks read the merge checks from the merge check hooks, the
+// required builds and the pull request settings.
+func (m *migration) GetMergeChecks(projectKey, repoSlug string) (MergeChecks, error) {
+	settings, err := m.Bitbucket.GetPullRequestSettings(projectKey, repoSlug)
+	if err != nil {
+		return MergeChecks{}, err
+	}
+
+	hooks, err := m.Bitbucket.GetMergeCheckHooks(projectKey, repoSlug)
+	if err != nil {
+		return MergeChecks{}, err
+	}
+	hookSettings := map[string]map[string]interface{}{}
+	for _, h := range hooks {
+		if h.Details.Key != hookRequiredApprovers && h.Details.Key != hookRequiredBuilds {
+			continue
+		}
+		s, err := m.Bitbucket.GetHookSettings(projectKey, repoSlug, h.Details.Key)
+		if err != nil {
+			return MergeChecks{}, err
+		}
+		hookSettings[h.Details.Key] = s
+	}
+
+	keys, err := m.Bitbucket.GetRequiredBuilds(projectKey, repoSlug)
+	if err != nil {
+		return MergeChecks{}, err
+	}
+
+	return translateMergeChecks(settings, hooks, hookSettings, keys), nil
+}
+
+// translateMergeChecks express the pull request settings, the enabled merge
+// check hooks with their settings and the required build keys as gitea
+// branch protection requirements
+func translateMergeChecks(settings PullRequestSettings, hooks []Hook, hookSettings map[string]map[string]interface{}, buildKeys []string) MergeChecks {
+	checks := MergeChecks{
+		RequiredApprovals: settings.RequiredApprovers,
+		DismissStale:      settings.UnapproveOnUpdate,
+	}
+	unsupported := map[string]bool{}
+	report := func(check string) {
+		if !unsupported[check] {
+			unsupported[check] = true
+			checks.Unsupported = append(checks.Unsupported, check)
+		}
+	}
+	if settings.RequiredAllApprovers {
+		report(checkAllApprovers)
+	}
+	if settings.RequiredAllTasksComplete {
+		report(checkIncompleteTask)
+	}
+
+	requiredBuilds := settings.RequiredSuccessfulBuilds
+	for _, h := range hooks {
+		switch h.Details.Key {
+		case hookRequiredApprovers:
+			checks.RequiredApprovals = max(checks.RequiredApprovals, settingInt(hookSettings[h.Details.Key], "requiredCount"))
+		case hookRequiredBuilds:
+			requiredBuilds = max(requiredBuilds, settingInt(hookSettings[h.Details.Key], "requiredCount"))
+		case hookNeedsWork:
+			checks.BlockOnRejected = true
+		case hookAllApprovers:
+			report(checkAllApprovers)
+		case hookIncompleteTasks:
+			report(checkIncompleteTask)
+		default:
+			report(h.Details.Name)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, k := range buildKeys {
+		if !seen[k] {
+			seen[k] = true
+			checks.StatusChecks = append(checks.StatusChecks, k)
+		}
+	}
+	sort.Strings(checks.StatusChecks)
+	// a number of successful builds can't be expressed without the build keys
+	if requiredBuilds > 0 && len(checks.StatusChecks) == 0 {
+		report("minimum successful builds " + strconv.Itoa(requiredBuilds))
+	}
+
+	return checks
+}
+
+// SetBranchProtection create the branch protection rule or update the
+// existing one, so the rule is never missing in between
+func (g *gitea) SetBranchProtection(owner, name string, opts gsdk.CreateBranchProtectionOption) error {
+	_, resp, err := g.client.GetBranchProtection(owner, name, opts.RuleName)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return err
+	}
+	if err != nil {
+		_, _, err = g.client.CreateBranchProtection(owner, name, opts)
+		return err
+	}
+
+	_, _, err = g.client.EditBranchProtection(owner, name, opts.RuleName, gsdk.EditBranchProtectionOption{
+		EnablePush:             gsdk.OptionalBool(opts.EnablePush),
+		RequiredApprovals:      gsdk.OptionalInt64(opts.RequiredApprovals),
+		EnableStatusCheck:      gsdk.OptionalBool(opts.EnableStatusCheck),
+		StatusCheckContexts:    append([]string{}, opts.StatusCheckContexts...),
+		BlockOnRejectedReviews: gsdk.OptionalBool(opts.BlockOnRejectedReviews),
+		DismissStaleApprovals:  gsdk.OptionalBool(opts.DismissStaleApprovals),
+	})
+	return err
+}
+
+// migrateMergeChecks express the bitbucket merge checks as the gitea branch
+// protection of all branches. Direct pushes stay allowed like in bitbucket,
+// and merge checks without gitea equivalent are reported.
+func (m *migration) migrateMergeChecks(opts MigrateNewRepoOption) error {
+	logger := m.repoLogger(opts)
+	checks, err := m.GetMergeChecks(opts.ProjectKey, opts.RepoSlug)
+	if err != nil {
+		return err
+	}
+	if len(checks.Unsupported) > 0 {
+		logger.Warn("merge checks not supported by gitea", "checks", checks.Unsupported)
+	}
+	if checks.Empty() {
+		return nil
+	}
+
+	logger.Info("start migrate merge checks",
+		"required_approvals", checks.RequiredApprovals,
+		"status_checks", checks.StatusChecks,
+		"block_on_rejected", checks.BlockOnRejected,
+		"dismiss_stale", checks.DismissStale,
+	)
+	return m.Gitea.SetBranchProtection(opts.Owner, opts.Name, gsdk.CreateBranchProtectionOption{
+		RuleName:               protectionRule,
+		EnablePush:             true,
+		RequiredApprovals:      int64(checks.RequiredApprovals),
+		EnableStatusCheck:      len(checks.StatusChecks) > 0,
+		StatusCheckContexts:    checks.StatusChecks,
+		BlockOnRejectedReviews: checks.BlockOnRejected,
+		DismissStaleApprovals:  checks.DismissStale,
+	})
+}
@@ -0,0 +1,99 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testHook enabled merge check hook with the key and name
+func testHook(key, name string) Hook {
+	h := Hook{Enabled: true}
+	h.Details.Key = key
+	h.Details.Name = name
+	return h
+}
+
+func TestTranslateMergeChecks(t *testing.T) {
+	tests := []struct {
+		name         string
+		settings     PullRequestSettings
+		hooks        []Hook
+		hookSettings map[string]map[string]interface{}
+		buildKeys    []string
+		want         MergeChecks
+	}{
+		{
+			name: "no merge checks",
+			want: MergeChecks{},
+		},
+		{
+			name:  "required approvers hook",
+			hooks: []Hook{testHook(hookRequiredApprovers, "Minimum approvals")},
+			hookSettings: map[string]map[string]interface{}{
+				hookRequiredApprovers: {"requiredCount": "2", "enable": true},
+			},
+			want: MergeChecks{RequiredApprovals: 2},
+		},
+		{
+			name:     "approvers of the hook and the settings",
+			settings: PullRequestSettings{RequiredApprovers: 3, UnapproveOnUpdate: true},
+			hooks:    []Hook{testHook(hookRequiredApprovers, "Minimum approvals")},
+			hookSettings: map[string]map[string]interface{}{
+				hookRequiredApprovers: {"requiredCount": float64(1)},
+			},
+			want: MergeChecks{RequiredApprovals: 3, DismissStale: true},
+		},
+		{
+			name:  "needs work hook",
+			hooks: []Hook{testHook(hookNeedsWork, "No 'needs work' status")},
+			want:  MergeChecks{BlockOnRejected: true},
+		},
+		{
+			name:  "required builds with build keys",
+			hooks: []Hook{testHook(hookRequiredBuilds, "Minimum successful builds")},
+			hookSettings: map[string]map[string]interface{}{
+				hookRequiredBuilds: {"requiredCount": "1"},
+			},
+			buildKeys: []string{"ci/test", "ci/build", "ci/test"},
+			want:      MergeChecks{StatusChecks: []string{"ci/build", "ci/test"}},
+		},
+		{
+			name:  "required builds without build keys",
+			hooks: []Hook{testHook(hookRequiredBuilds, "Minimum successful builds")},
+			hookSettings: map[string]map[string]interface{}{
+				hookRequiredBuilds: {"requiredCount": "2"},
+			},
+			want: MergeChecks{Unsupported: []string{"minimum successful builds 2"}},
+		},
+		{
+			name: "tasks and all approvers hooks",
+			hooks: []Hook{
+				testHook(hookIncompleteTasks, "No incomplete tasks"),
+				testHook(hookAllApprovers, "All reviewers approve"),
+			},
+			want: MergeChecks{Unsupported: []string{checkIncompleteTask, checkAllApprovers}},
+		},
+		{
+			name:     "tasks and all approvers of the hooks and the settings reported once",
+			settings: PullRequestSettings{RequiredAllApprovers: true, RequiredAllTasksComplete: true},
+			hooks: []Hook{
+				testHook(hookIncompleteTasks, "No incomplete tasks"),
+				testHook(hookAllApprovers, "All reviewers approve"),
+			},
+			want: MergeChecks{Unsupported: []string{checkAllApprovers, checkIncompleteTask}},
+		},
+		{
+			name:  "merge check of another app",
+			hooks: []Hook{testHook("com.example.jira:issue-merge-check", "Jira issue check")},
+			want:  MergeChecks{Unsupported: []string{"Jira issue check"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateMergeChecks(tt.settings, tt.hooks, tt.hookSettings, tt.buildKeys)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merge checks %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
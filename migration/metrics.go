@@ -0,0 +1,127 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "bitbucketserver2gitea"
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	repositoriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "repositories_total",
+		Help:      "Number of processed repositories by result: migrated, failed, skipped or blocked.",
+	}, []string{"result"})
+	transferredBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "transferred_bytes_total",
+		Help:      "Bytes received and sent by git and git-lfs by direction, as reported by their progress output.",
+	}, []string{"direction"})
+	repositoryDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "repository_duration_seconds",
+		Help:      "Migration duration of the repositories.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "API request latencies by server, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server", "method", "code"})
+	apiRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_retries_total",
+		Help:      "Number of retried API requests by server.",
+	}, []string{"server"})
+	rateLimitWaits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_waits_total",
+		Help:      "Number of requests delayed by the rate limit by server.",
+	}, []string{"server"})
+	rateLimitWaitSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_wait_seconds_total",
+		Help:      "Time spent waiting for the rate limit by server.",
+	}, []string{"server"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		repositoriesTotal,
+		transferredBytes,
+		repositoryDuration,
+		apiRequestDuration,
+		apiRetries,
+		rateLimitWaits,
+		rateLimitWaitSeconds,
+	)
+}
+
+// observeRequest record the latency of the API request
+func observeRequest(server, method string, resp *http.Response, start time.Time) {
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequestDuration.WithLabelValues(server, method, code).Observe(time.Since(start).Seconds())
+}
+
+// observeRepository record the result of the repository migration
+func observeRepository(err error, start time.Time) {
+	result := "migrated"
+	switch {
+	case err == nil:
+		repositoryDuration.Observe(time.Since(start).Seconds())
+	case errors.Is(err, errSkipped):
+		result = "skipped"
+	case errors.Is(err, errBlocked):
+		result = "blocked"
+	default:
+		result = "failed"
+	}
+	repositoriesTotal.WithLabelValues(result).Inc()
+}
+
+// ServeMetrics serve the prometheus metrics on the address until the
+// context is done.
+func ServeMetrics(ctx context.Context, logger *slog.Logger, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server error", "error", err)
+		}
+	}()
+
+	logger.Info("serve metrics", "addr", "http://"+listener.Addr().String()+"/metrics")
+	return nil
+}
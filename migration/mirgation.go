@@ -2,29 +2,118 @@ package migration
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
+	gsdk "code.gitea.io/sdk/gitea"
 	bitbucketv1 "github.com/gfleury/go-bitbucket-v1"
 )
 
 type migration struct {
-	ctx       context.Context
-	Bitbucket *bitbucket
-	Gitea     *gitea
-	Logger    *slog.Logger
+	ctx         context.Context
+	Bitbucket   *bitbucket
+	Gitea       *gitea
+	Logger      *slog.Logger
+	transfer    TransferMode
+	protocol    string
+	workspace   string
+	lfs         LFSOption
+	naming      *naming
+	conflict    ConflictPolicy
+	archived    ArchivedOption
+	release     ReleaseOption
+	topics      map[string]string
+	jira        JiraOption
+	buildStatus BuildStatusOption
+	mergeChecks bool
+	audit       map[string]AuditReport
+	notifier    *notifier
+	progress    *progress
+	timeout     time.Duration
+	interval    time.Duration
+}
+
+// TransferMode repository transfer mode
+type TransferMode string
+
+const (
+	// TransferPull gitea pulls the repository from bitbucket by migrate API
+	TransferPull TransferMode = "pull"
+	// TransferPush clone the repository locally and push it to gitea
+	TransferPush TransferMode = "push"
+)
+
+// LFSOption git lfs migration option
+type LFSOption struct {
+	Enabled  bool
+	Endpoint string
+	// Fallback upload the lfs objects missing in gitea after the pull migration
+	Fallback bool
+}
+
+// ArchivedOption migration option for archived bitbucket repositories.
+// The gitea repository is archived after the migration.
+type ArchivedOption struct {
+	// Skip don't migrate archived repositories
+	Skip bool
+	// Org migrate archived repositories into this organization, unless
+	// the manifest sets the target owner
+	Org string
 }
 
 // Option migration option
 type Option struct {
-	Debug bool
+	Debug     bool
+	Transfer  TransferMode
+	Workspace string
+	LFS       LFSOption
+	// CloneProtocol bitbucket clone link protocol, http or ssh
+	CloneProtocol string
+	Naming        NamingOption
+	// OnConflict action when the target repository exists, default is skip
+	OnConflict ConflictPolicy
+	Archived   ArchivedOption
+	Release    ReleaseOption
+	// Topics mapping of bitbucket labels to gitea topics
+	Topics      map[string]string
+	Jira        JiraOption
+	BuildStatus BuildStatusOption
+	// MergeChecks translate the merge checks into gitea branch protection
+	MergeChecks bool
+	// AuditReports audit reports by source, blocked repositories aren't migrated
+	AuditReports map[string]AuditReport
+	// Progress show the progress view when stdout is a terminal
+	Progress bool
+	// RepoTimeout timeout for each repository migration, independent of the run
+	RepoTimeout time.Duration
+	// PollInterval interval for polling the gitea migration status
+	PollInterval time.Duration
+	// SourceOnly create only the bitbucket client, for the commands which
+	// don't write to gitea
+	SourceOnly bool
 }
 
 // NewMigration creates a new instance of the migration struct.
 func NewMigration(ctx context.Context, opts Option) (*migration, error) {
 	logLevel := &slog.LevelVar{} // INFO
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	// the progress view prints the log lines above the bars
+	var out io.Writer = os.Stdout
+	var view *progress
+	if opts.Progress {
+		view = newProgress(os.Stdout)
+	}
+	if view != nil {
+		out = view
+		ctx = withProgress(ctx, view)
+	}
+	handler := slog.NewTextHandler(out, &slog.HandlerOptions{
 		Level: logLevel,
 	})
 
@@ -34,27 +123,98 @@ func NewMigration(ctx context.Context, opts Option) (*migration, error) {
 
 	l := slog.New(handler)
 
-	// initial bitbucket client
-	b, err := NewBitbucket(ctx, l)
+	n, err := newNaming(opts.Naming)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := path.Match(opts.Release.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("release pattern: %w", err)
+	}
+	if opts.Archived.Org != "" {
+		if err := validateOwnerName(opts.Archived.Org); err != nil {
+			return nil, fmt.Errorf("archive org: %w", err)
+		}
+	}
 
-	g, err := NewGitea(ctx, l)
+	// initial bitbucket client
+	b, err := NewBitbucket(ctx, l)
 	if err != nil {
 		return nil, err
 	}
 
+	var g *gitea
+	var notify *notifier
+	if !opts.SourceOnly {
+		g, err = NewGitea(ctx, l)
+		if err != nil {
+			return nil, err
+		}
+
+		notify, err = newNotifier(ctx, l)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Jira.Enabled && opts.Jira.URL == "" {
+		opts.Jira.URL, err = b.JiraURL()
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts.Jira.URL = strings.TrimSuffix(opts.Jira.URL, "/")
+
+	if opts.Transfer == "" {
+		opts.Transfer = TransferPull
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictSkip
+	}
+	if opts.CloneProtocol == "" {
+		opts.CloneProtocol = "http"
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+	if opts.Workspace == "" {
+		opts.Workspace = filepath.Join(os.TempDir(), "bitbucketServer2Gitea")
+	}
+
 	m := &migration{
-		ctx:       ctx,
-		Bitbucket: b,
-		Gitea:     g,
-		Logger:    l,
+		ctx:         ctx,
+		Bitbucket:   b,
+		Gitea:       g,
+		Logger:      l,
+		transfer:    opts.Transfer,
+		protocol:    opts.CloneProtocol,
+		workspace:   opts.Workspace,
+		lfs:         opts.LFS,
+		naming:      n,
+		conflict:    opts.OnConflict,
+		archived:    opts.Archived,
+		release:     opts.Release,
+		topics:      opts.Topics,
+		jira:        opts.Jira,
+		buildStatus: opts.BuildStatus,
+		mergeChecks: opts.MergeChecks,
+		audit:       opts.AuditReports,
+		notifier:    notify,
+		progress:    view,
+		timeout:     opts.RepoTimeout,
+		interval:    opts.PollInterval,
 	}
 
 	return m, nil
 }
 
+// RateLimitStats get the rate limit wait statistics per server
+func (m *migration) RateLimitStats() map[string]RateLimitStats {
+	return map[string]RateLimitStats{
+		"bitbucket": m.Bitbucket.limiter.Stats(),
+		"gitea":     m.Gitea.limiter.Stats(),
+	}
+}
+
 // CreateNewOrgOption create new organization option
 type CreateNewOrgOption struct {
 	Name        string
@@ -93,12 +253,18 @@ func (m *migration) CreateNewOrg(opts CreateNewOrgOption) error {
 
 // MigrateNewRepoOption migrate repository option
 type MigrateNewRepoOption struct {
+	ProjectKey  string
+	RepoSlug    string
 	Owner       string
 	Name        string
 	CloneAddr   string
 	Description string
 	Private     bool
-	Permission  map[string][]string
+	// Mirror create a pull mirror of the bitbucket repository
+	Mirror bool
+	// ForkOf the migrated parent, the repository is created as its fork
+	ForkOf     *ManifestEntry
+	Permission map[string][]string
 }
 
 // MigrateNewRepo migrate repository
@@ -107,19 +273,72 @@ func (m *migration) MigrateNewRepo(opts MigrateNewRepoOption) error {
 		"owner", opts.Owner,
 		"name", opts.Name,
 	)
-	_, err := m.Gitea.MigrateRepo(MigrateRepoOption{
-		RepoName:     opts.Name,
-		RepoOwner:    opts.Owner,
-		CloneAddr:    opts.CloneAddr,
-		Private:      opts.Private,
-		Description:  opts.Description,
-		AuthUsername: m.Bitbucket.Username,
-		AuthPassword: m.Bitbucket.Token,
-	})
-	if err != nil {
-		return err
+	ctx, cancel := m.repoContext()
+	defer cancel()
+
+	// permissions right after the transfer, so the repository is usable
+	// even if the optional steps fail
+	steps := []repoStep{
+		{name: "transfer", run: func() error {
+			if opts.ForkOf != nil {
+				return m.forkNewRepo(ctx, opts)
+			}
+			return m.transferNewRepo(ctx, opts)
+		}},
+		{name: "permissions", run: func() error { return m.migrateRepoPermission(opts) }},
+		bestEffort("settings", func() error { return m.migrateRepoSettings(opts) }),
+		bestEffort("topics", func() error { return m.migrateRepoTopics(opts) }),
+	}
+	if m.jira.Enabled {
+		steps = append(steps, bestEffort("jira", func() error { return m.migrateJira(opts) }))
+	}
+	if m.buildStatus.Enabled {
+		steps = append(steps, bestEffort("build statuses", func() error { return m.migrateBuildStatuses(opts) }))
+	}
+	if m.mergeChecks {
+		steps = append(steps, bestEffort("merge checks", func() error { return m.migrateMergeChecks(opts) }))
+	}
+	// gitea doesn't allow releases in mirror repositories
+	if m.release.Pattern != "" && !opts.Mirror {
+		steps = append(steps, bestEffort("releases", func() error { return m.migrateReleases(ctx, opts) }))
+	}
+
+	return m.runSteps(opts, steps)
+}
+
+// repoStep single step of the repository migration
+type repoStep struct {
+	name string
+	run  func() error
+	// optional failures are logged and don't fail the repository
+	optional bool
+}
+
+// bestEffort optional step for the metadata gitea works without, so a
+// missing bitbucket permission doesn't fail the migrated repository.
+func bestEffort(name string, run func() error) repoStep {
+	return repoStep{name: name, run: run, optional: true}
+}
+
+// runSteps run the steps in order, showing the current step in the progress view
+func (m *migration) runSteps(opts MigrateNewRepoOption, steps []repoStep) error {
+	for i, step := range steps {
+		m.progress.Step(step.name, i, len(steps))
+		err := step.run()
+		if err != nil && step.optional {
+			m.repoLogger(opts).Warn("migrate repo "+step.name+" failed", "error", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+// migrateRepoPermission add the bitbucket repository permissions as collaborators
+func (m *migration) migrateRepoPermission(opts MigrateNewRepoOption) error {
 	m.Logger.Info("start migrate repo permission",
 		"owner", opts.Owner,
 		"name", opts.Name,
@@ -135,6 +354,168 @@ func (m *migration) MigrateNewRepo(opts MigrateNewRepoOption) error {
 	return nil
 }
 
+// transferNewRepo create the repository by the transfer mode
+func (m *migration) transferNewRepo(ctx context.Context, opts MigrateNewRepoOption) error {
+	if m.transfer == TransferPush {
+		return m.pushNewRepo(ctx, opts)
+	}
+
+	return m.pullNewRepo(ctx, opts)
+}
+
+// pullNewRepo migrate the repository by gitea migrate API.
+func (m *migration) pullNewRepo(ctx context.Context, opts MigrateNewRepoOption) error {
+	username, password := m.Bitbucket.CloneCredential(opts.ProjectKey, opts.RepoSlug)
+	repo, err := m.Gitea.WaitMigrateRepo(ctx, MigrateRepoOption{
+		RepoName:     opts.Name,
+		RepoOwner:    opts.Owner,
+		CloneAddr:    opts.CloneAddr,
+		Private:      opts.Private,
+		Description:  opts.Description,
+		Mirror:       opts.Mirror,
+		AuthUsername: username,
+		AuthPassword: password,
+		LFS:          m.lfs.Enabled,
+		LFSEndpoint:  m.lfs.Endpoint,
+	}, m.cloneRemote(opts), m.interval)
+	if err != nil {
+		return err
+	}
+
+	if !m.lfs.Enabled {
+		return nil
+	}
+
+	logger := m.repoLogger(opts)
+	dir, err := clonePointers(ctx, logger, m.workspace, m.cloneRemote(opts))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if !m.lfs.Fallback {
+		return m.migrateLFS(ctx, opts, repo, dir, nil)
+	}
+	// the full clone is only needed for uploading the missing objects
+	return m.migrateLFS(ctx, opts, repo, dir, func() error {
+		full, err := cloneMirror(ctx, logger, m.workspace, m.cloneRemote(opts))
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(full)
+
+		return pushLFS(ctx, logger, full, m.cloneRemote(opts), m.Gitea.PushRemote(repo))
+	})
+}
+
+// pushNewRepo create an empty gitea repository, clone the bitbucket
+// repository locally and push all branches and tags to gitea.
+func (m *migration) pushNewRepo(ctx context.Context, opts MigrateNewRepoOption) error {
+	repo, err := m.Gitea.CreateRepo(CreateRepoOption{
+		RepoName:    opts.Name,
+		RepoOwner:   opts.Owner,
+		Private:     opts.Private,
+		Description: opts.Description,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger := m.repoLogger(opts)
+	err = m.pushRepoContent(ctx, opts, repo)
+	if err != nil {
+		logger.Warn("delete repository of failed migration")
+		if derr := m.Gitea.DeleteRepo(opts.Owner, opts.Name); derr != nil {
+			return errors.Join(err, fmt.Errorf("delete repository: %w", derr))
+		}
+	}
+
+	return err
+}
+
+// pushRepoContent push the git data and lfs objects into the gitea repository.
+func (m *migration) pushRepoContent(ctx context.Context, opts MigrateNewRepoOption, repo *gsdk.Repository) error {
+	logger := m.repoLogger(opts)
+	dir, err := cloneMirror(ctx, logger, m.workspace, m.cloneRemote(opts))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := pushMirror(ctx, logger, dir, m.Gitea.PushRemote(repo)); err != nil {
+		return err
+	}
+
+	if !m.lfs.Enabled {
+		return nil
+	}
+
+	return m.migrateLFS(ctx, opts, repo, dir, func() error {
+		return pushLFS(ctx, logger, dir, m.cloneRemote(opts), m.Gitea.PushRemote(repo))
+	})
+}
+
+// migrateLFS verify all lfs objects referenced in the mirror clone exist in
+// gitea, and upload the missing objects from bitbucket if upload isn't nil.
+func (m *migration) migrateLFS(ctx context.Context, opts MigrateNewRepoOption, repo *gsdk.Repository, dir string, upload func() error) error {
+	logger := m.repoLogger(opts)
+	objects, err := lfsObjects(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		logger.Info("no lfs objects found")
+		return nil
+	}
+
+	missing, err := m.Gitea.MissingLFSObjects(repo.CloneURL, objects)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 && upload != nil {
+		logger.Info("upload missing lfs objects", "missing", len(missing), "total", len(objects))
+		if err := upload(); err != nil {
+			return err
+		}
+		missing, err = m.Gitea.MissingLFSObjects(repo.CloneURL, objects)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%d of %d lfs objects missing in gitea", len(missing), len(objects))
+	}
+
+	logger.Info("lfs objects verified", "total", len(objects))
+	return nil
+}
+
+// repoContext get the context for a single repository migration.
+// It isn't canceled by the run timeout, so a long running migration
+// is only limited by the repository timeout.
+func (m *migration) repoContext() (context.Context, context.CancelFunc) {
+	ctx := context.WithoutCancel(m.ctx)
+	if m.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, m.timeout)
+}
+
+// cloneRemote get the bitbucket git remote of the repository
+func (m *migration) cloneRemote(opts MigrateNewRepoOption) GitRemote {
+	remote := m.Bitbucket.CloneRemote(opts.ProjectKey, opts.RepoSlug, opts.CloneAddr)
+	remote.LFSURL = m.lfs.Endpoint
+	return remote
+}
+
+// repoLogger get the logger with repository attributes
+func (m *migration) repoLogger(opts MigrateNewRepoOption) *slog.Logger {
+	return m.Logger.With("owner", opts.Owner, "name", opts.Name)
+}
+
 // ProjectResponse project response
 type ProjectResponse struct {
 	Project    bitbucketv1.Project
@@ -225,7 +606,7 @@ func (m *migration) GetProjectData(projectKey string) (*ProjectResponse, error)
 
 // RepositoryResponse repository response
 type RepositoryResponse struct {
-	Repository bitbucketv1.Repository
+	Repository Repository
 	Permission map[string][]string
 }
 
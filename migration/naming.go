@@ -0,0 +1,233 @@
+package migration
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// reservedOwnerNames user and organization names reserved by gitea
+var reservedOwnerNames = []string{
+	".", "..", ".well-known", "admin", "api", "assets", "attachments",
+	"avatar", "avatars", "captcha", "commit", "debug", "devtest", "error",
+	"explore", "favicon.ico", "ghost", "gitea-actions", "issues", "login",
+	"manifest.json", "metrics", "milestones", "new", "notifications", "org",
+	"pulls", "raw", "repo", "repo-avatars", "robots.txt", "search",
+	"serviceworker.js", "ssh_info", "swagger.v1.json", "user", "v2",
+}
+
+// reservedOwnerPatterns user and organization name patterns reserved by gitea
+var reservedOwnerPatterns = []string{"*.keys", "*.gpg", "*.rss", "*.atom", "*.png"}
+
+// reservedRepoNames repository names reserved by gitea
+var reservedRepoNames = []string{".", "..", "-"}
+
+// reservedRepoPatterns repository name patterns reserved by gitea
+var reservedRepoPatterns = []string{"*.git", "*.rss", "*.atom", "*.wiki"}
+
+const (
+	maxOwnerNameLength = 40
+	maxRepoNameLength  = 100
+)
+
+// NamingOption templates for the gitea organization and repository names.
+// The templates are executed with NameData, and the result is sanitized
+// to follow the gitea name rules.
+type NamingOption struct {
+	// Owner organization name template, default is the project name
+	Owner string
+	// Repo repository name template, default is the repository name
+	Repo string
+	// Replacement replaces the invalid characters, one of - _ . or empty
+	Replacement string
+}
+
+// NameData values of the naming templates
+type NameData struct {
+	ProjectKey  string
+	ProjectName string
+	RepoSlug    string
+	RepoName    string
+}
+
+type naming struct {
+	owner       *template.Template
+	repo        *template.Template
+	replacement string
+}
+
+// namingFuncs functions of the naming templates
+var namingFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+func newNaming(opts NamingOption) (*naming, error) {
+	if opts.Owner == "" {
+		opts.Owner = "{{ .ProjectName }}"
+	}
+	if opts.Repo == "" {
+		opts.Repo = "{{ .RepoName }}"
+	}
+	switch opts.Replacement {
+	case "", "-", "_", ".":
+	default:
+		return nil, fmt.Errorf("naming replacement %q invalid, must be one of - _ . or empty", opts.Replacement)
+	}
+
+	owner, err := template.New("owner").Funcs(namingFuncs).Option("missingkey=error").Parse(opts.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("owner template: %w", err)
+	}
+	repo, err := template.New("repo").Funcs(namingFuncs).Option("missingkey=error").Parse(opts.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("repo template: %w", err)
+	}
+
+	return &naming{
+		owner:       owner,
+		repo:        repo,
+		replacement: opts.Replacement,
+	}, nil
+}
+
+// Owner get the sanitized organization name
+func (n *naming) Owner(data NameData) (string, error) {
+	name, err := execute(n.owner, data)
+	if err != nil {
+		return "", err
+	}
+
+	return sanitizeOwnerName(name, n.replacement), nil
+}
+
+// Repo get the sanitized repository name
+func (n *naming) Repo(data NameData) (string, error) {
+	name, err := execute(n.repo, data)
+	if err != nil {
+		return "", err
+	}
+
+	return sanitizeRepoName(name, n.replacement), nil
+}
+
+func execute(t *template.Template, data NameData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isNameChar(c byte) bool {
+	return isAlphanumeric(c) || c == '-' || c == '_' || c == '.'
+}
+
+// replaceInvalid replace the characters gitea doesn't allow in names,
+// consecutive invalid characters are replaced once.
+func replaceInvalid(name, replacement string) string {
+	var b strings.Builder
+	replaced := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isNameChar(c) {
+			b.WriteByte(c)
+			replaced = false
+			continue
+		}
+		if !replaced {
+			b.WriteString(replacement)
+			replaced = true
+		}
+	}
+	return b.String()
+}
+
+// sanitizeOwnerName convert the name to a valid gitea organization name:
+// alphanumeric, dash, underscore and dot, starting and ending with an
+// alphanumeric character and no consecutive special characters.
+func sanitizeOwnerName(name, replacement string) string {
+	name = replaceInvalid(name, replacement)
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !isAlphanumeric(c) && (b.Len() == 0 || !isAlphanumeric(b.String()[b.Len()-1])) {
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	name = b.String()
+	if len(name) > maxOwnerNameLength {
+		name = name[:maxOwnerNameLength]
+	}
+	return strings.TrimRight(name, "-_.")
+}
+
+// sanitizeRepoName convert the name to a valid gitea repository name
+func sanitizeRepoName(name, replacement string) string {
+	name = replaceInvalid(name, replacement)
+	if replacement != "" {
+		name = strings.Trim(name, replacement)
+	}
+	if len(name) > maxRepoNameLength {
+		name = name[:maxRepoNameLength]
+	}
+	return name
+}
+
+// validateOwnerName check the organization name follows the gitea rules
+func validateOwnerName(name string) error {
+	if name == "" {
+		return fmt.Errorf("owner name can't be empty")
+	}
+	if len(name) > maxOwnerNameLength {
+		return fmt.Errorf("owner name %q longer than %d characters", name, maxOwnerNameLength)
+	}
+	if sanitizeOwnerName(name, "") != name {
+		return fmt.Errorf("owner name %q invalid, only alphanumeric, dash, underscore and dot are allowed, and it must start and end with an alphanumeric character", name)
+	}
+
+	return reservedName("owner", name, reservedOwnerNames, reservedOwnerPatterns)
+}
+
+// validateRepoName check the repository name follows the gitea rules
+func validateRepoName(name string) error {
+	if name == "" {
+		return fmt.Errorf("repo name can't be empty")
+	}
+	if len(name) > maxRepoNameLength {
+		return fmt.Errorf("repo name %q longer than %d characters", name, maxRepoNameLength)
+	}
+	if replaceInvalid(name, "") != name {
+		return fmt.Errorf("repo name %q invalid, only alphanumeric, dash, underscore and dot are allowed", name)
+	}
+
+	return reservedName("repo", name, reservedRepoNames, reservedRepoPatterns)
+}
+
+func reservedName(kind, name string, names, patterns []string) error {
+	lower := strings.ToLower(name)
+	for _, n := range names {
+		if lower == n {
+			return fmt.Errorf("%s name %q is reserved by gitea", kind, name)
+		}
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, lower); ok {
+			return fmt.Errorf("%s name %q is reserved by gitea", kind, name)
+		}
+	}
+	return nil
+}
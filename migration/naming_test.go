@@ -0,0 +1,174 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeOwnerName(t *testing.T) {
+	tests := []struct {
+		name        string
+		replacement string
+		want        string
+	}{
+		{"Payments Platform (Legacy)", "-", "Payments-Platform-Legacy"},
+		{"Payments Platform (Legacy)", "_", "Payments_Platform_Legacy"},
+		{"Payments Platform (Legacy)", ".", "Payments.Platform.Legacy"},
+		{"Payments Platform (Legacy)", "", "PaymentsPlatformLegacy"},
+		{"--a..b__c--", "-", "a.b_c"},
+		{"Zahlungsverkehr Über", "-", "Zahlungsverkehr-ber"},
+		{"(Legacy)", "-", "Legacy"},
+		{strings.Repeat("a", 50), "-", strings.Repeat("a", maxOwnerNameLength)},
+		// the cut must not leave a special character at the end
+		{strings.Repeat("a", 39) + " b", "-", strings.Repeat("a", 39)},
+		{"()", "-", ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeOwnerName(tt.name, tt.replacement); got != tt.want {
+			t.Errorf("sanitizeOwnerName(%q, %q) = %q, want %q", tt.name, tt.replacement, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeRepoName(t *testing.T) {
+	tests := []struct {
+		name        string
+		replacement string
+		want        string
+	}{
+		{"Payments Platform (Legacy)", "-", "Payments-Platform-Legacy"},
+		{"Payments Platform (Legacy)", "_", "Payments_Platform_Legacy"},
+		{"Payments Platform (Legacy)", "", "PaymentsPlatformLegacy"},
+		{"my  service!", ".", "my.service"},
+		{"a..b--c", "-", "a..b--c"},
+		{"_internal_", "-", "_internal_"},
+		{strings.Repeat("r", 120), "-", strings.Repeat("r", maxRepoNameLength)},
+	}
+	for _, tt := range tests {
+		if got := sanitizeRepoName(tt.name, tt.replacement); got != tt.want {
+			t.Errorf("sanitizeRepoName(%q, %q) = %q, want %q", tt.name, tt.replacement, got, tt.want)
+		}
+	}
+}
+
+func TestValidateOwnerName(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"payments-platform", ""},
+		{"Payments.Platform_2", ""},
+		{"", "can't be empty"},
+		{"Payments Platform (Legacy)", "invalid"},
+		{"-payments", "invalid"},
+		{"payments-", "invalid"},
+		{"payments--platform", "invalid"},
+		{strings.Repeat("a", maxOwnerNameLength), ""},
+		{strings.Repeat("a", maxOwnerNameLength+1), "longer than 40 characters"},
+		{"admin", "reserved"},
+		{"Explore", "reserved"},
+		{"team.keys", "reserved"},
+		{"logo.PNG", "reserved"},
+	}
+	for _, tt := range tests {
+		checkNameError(t, "validateOwnerName", tt.name, validateOwnerName(tt.name), tt.err)
+	}
+}
+
+func TestValidateRepoName(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"payments-platform", ""},
+		{"_internal..tools-", ""},
+		{"", "can't be empty"},
+		{"Payments Platform (Legacy)", "invalid"},
+		{strings.Repeat("r", maxRepoNameLength), ""},
+		{strings.Repeat("r", maxRepoNameLength+1), "longer than 100 characters"},
+		{"..", "reserved"},
+		{"-", "reserved"},
+		{"service.git", "reserved"},
+		{"docs.WIKI", "reserved"},
+	}
+	for _, tt := range tests {
+		checkNameError(t, "validateRepoName", tt.name, validateRepoName(tt.name), tt.err)
+	}
+}
+
+func checkNameError(t *testing.T, fn, name string, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Errorf("%s(%q) unexpected error %v", fn, name, err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("%s(%q) error %v, want %q", fn, name, err, want)
+	}
+}
+
+func TestNaming(t *testing.T) {
+	data := NameData{
+		ProjectKey:  "PAY",
+		ProjectName: "Payments Platform (Legacy)",
+		RepoSlug:    "svc-billing",
+		RepoName:    "Billing Service",
+	}
+
+	tests := []struct {
+		name  string
+		opts  NamingOption
+		owner string
+		repo  string
+	}{
+		{"default", NamingOption{Replacement: "-"}, "Payments-Platform-Legacy", "Billing-Service"},
+		{"no replacement", NamingOption{}, "PaymentsPlatformLegacy", "BillingService"},
+		{
+			"templates",
+			NamingOption{
+				Owner:       "{{ .ProjectKey | lower }}-{{ .ProjectName | trimSuffix \" (Legacy)\" }}",
+				Repo:        "{{ .RepoSlug | trimPrefix \"svc-\" }}",
+				Replacement: "_",
+			},
+			"pay-Payments_Platform", "billing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := newNaming(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			owner, err := n.Owner(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo, err := n.Repo(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owner != tt.owner || repo != tt.repo {
+				t.Errorf("names %q/%q, want %q/%q", owner, repo, tt.owner, tt.repo)
+			}
+		})
+	}
+}
+
+func TestNamingErrors(t *testing.T) {
+	if _, err := newNaming(NamingOption{Replacement: "+"}); err == nil {
+		t.Error("expected invalid replacement error")
+	}
+	if _, err := newNaming(NamingOption{Owner: "{{ .ProjectName"}); err == nil {
+		t.Error("expected owner template error")
+	}
+
+	n, err := newNaming(NamingOption{Repo: "{{ .Unknown }}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Repo(NameData{}); err == nil {
+		t.Error("expected unknown field error")
+	}
+}
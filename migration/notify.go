@@ -0,0 +1,340 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// EventType notification event type
+type EventType string
+
+const (
+	EventRunStart       EventType = "run-start"
+	EventRunFinish      EventType = "run-finish"
+	EventRunFailure     EventType = "run-failure"
+	EventProjectStart   EventType = "project-start"
+	EventProjectFinish  EventType = "project-finish"
+	EventProjectFailure EventType = "project-failure"
+)
+
+// EventTypes all notification event types
+var EventTypes = []EventType{
+	EventRunStart, EventRunFinish, EventRunFailure,
+	EventProjectStart, EventProjectFinish, EventProjectFailure,
+}
+
+// defaultTemplates message templates of the events
+var defaultTemplates = map[EventType]string{
+	EventRunStart: `Migration started: {{ .Total }} repositories to {{ .URL }}`,
+	EventRunFinish: `Migration finished in {{ .Duration }}: {{ .Migrated }} of {{ .Total }} repositories migrated` +
+		`{{ if .Skipped }}, {{ .Skipped }} skipped{{ end }}{{ if .Blocked }}, {{ .Blocked }} blocked{{ end }}`,
+	EventRunFailure: `Migration failed after {{ .Duration }}: {{ .Error }}` +
+		`{{ range .Failures }}` + "\n" + `- {{ . }}{{ end }}`,
+	EventProjectStart: `Project {{ .Project }} started: {{ .Total }} repositories to {{ .URL }}`,
+	EventProjectFinish: `Project {{ .Project }} finished in {{ .Duration }}: {{ .Migrated }} of {{ .Total }} repositories migrated to {{ .URL }}` +
+		`{{ if .Skipped }}, {{ .Skipped }} skipped{{ end }}{{ if .Blocked }}, {{ .Blocked }} blocked{{ end }}`,
+	EventProjectFailure: `Project {{ .Project }} {{ if .Error }}stopped after {{ .Duration }}: {{ .Error }}` +
+		`{{ else }}finished in {{ .Duration }} with {{ .Failed }} of {{ .Total }} repositories failed{{ end }}, see {{ .URL }}` +
+		`{{ range .Failures }}` + "\n" + `- {{ . }}{{ end }}`,
+}
+
+// Event notification event of the run or a project
+type Event struct {
+	Type EventType `json:"event"`
+	// Project the bitbucket project key, empty for run events
+	Project string `json:"project,omitempty"`
+	// Owner the gitea organization of the project
+	Owner string `json:"owner,omitempty"`
+	// URL the gitea organization, or the gitea server for run events
+	URL      string `json:"url"`
+	Total    int    `json:"total"`
+	Migrated int    `json:"migrated"`
+	Skipped  int    `json:"skipped"`
+	Blocked  int    `json:"blocked"`
+	Failed   int    `json:"failed"`
+	// Failures the failed repositories with the error
+	Failures []string `json:"failures,omitempty"`
+	Duration string   `json:"duration,omitempty"`
+	Error    string   `json:"error,omitempty"`
+
+	start time.Time
+}
+
+// count add the result of the repository migration
+func (e *Event) count(entry ManifestEntry, err error) {
+	switch {
+	case err == nil:
+		e.Migrated++
+	case errors.Is(err, errSkipped):
+		e.Skipped++
+	case errors.Is(err, errBlocked):
+		e.Blocked++
+	default:
+		e.Failed++
+		e.Failures = append(e.Failures, entry.Source()+": "+err.Error())
+	}
+}
+
+// done check all repositories of the event are counted
+func (e *Event) done() bool {
+	return e.Migrated+e.Skipped+e.Blocked+e.Failed >= e.Total
+}
+
+// finish set the finish or failure event type and the duration
+func (e *Event) finish(success, failure EventType) {
+	e.Type = success
+	if e.Failed > 0 || e.Error != "" {
+		e.Type = failure
+	}
+	e.Duration = time.Since(e.start).Round(time.Second).String()
+}
+
+// WebhookType payload format of the webhook
+type WebhookType string
+
+const (
+	// WebhookJSON the event as json with the message as text
+	WebhookJSON WebhookType = "json"
+	// WebhookSlack slack incoming webhook
+	WebhookSlack WebhookType = "slack"
+	// WebhookMattermost mattermost incoming webhook, slack compatible
+	WebhookMattermost WebhookType = "mattermost"
+	// WebhookTeams microsoft teams incoming webhook
+	WebhookTeams WebhookType = "teams"
+)
+
+// Webhook notification target
+type Webhook struct {
+	Name   string
+	URL    string
+	Type   WebhookType
+	Events []EventType
+
+	template *template.Template
+}
+
+// accepts check the webhook is subscribed to the event, all events by default
+func (w Webhook) accepts(t EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// notifier posts the run and project events to the webhooks
+type notifier struct {
+	ctx       context.Context
+	logger    *slog.Logger
+	client    *http.Client
+	webhooks  []Webhook
+	templates map[EventType]*template.Template
+}
+
+var notifyFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"join":  func(sep string, values []string) string { return strings.Join(values, sep) },
+}
+
+// newNotifier load the webhooks of the notify config, returns nil if no
+// webhook is configured.
+//
+//	notify.webhooks.<name>.url       webhook URL, also read from url_file, url_env or url_command
+//	notify.webhooks.<name>.type      json, slack, mattermost or teams
+//	notify.webhooks.<name>.events    subscribed events, default all
+//	notify.webhooks.<name>.template  message template of all events
+//	notify.templates.<event>         message template of the event
+func newNotifier(ctx context.Context, logger *slog.Logger) (*notifier, error) {
+	names := []string{}
+	for name := range viper.GetStringMap("notify.webhooks") {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	n := &notifier{
+		// the run failure is sent after the run timeout, the requests are
+		// limited by the client timeout instead
+		ctx:       context.WithoutCancel(ctx),
+		logger:    logger,
+		templates: map[EventType]*template.Template{},
+	}
+	for _, t := range EventTypes {
+		text := defaultTemplates[t]
+		if custom := viper.GetString("notify.templates." + string(t)); custom != "" {
+			text = custom
+		}
+		tmpl, err := template.New(string(t)).Funcs(notifyFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("notify template %s: %w", t, err)
+		}
+		n.templates[t] = tmpl
+	}
+
+	for _, name := range names {
+		w, err := loadWebhook(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("notify webhook %s: %w", name, err)
+		}
+		n.webhooks = append(n.webhooks, w)
+	}
+
+	client, err := newHTTPClient("notify", logger, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 30 * time.Second
+	n.client = client
+
+	return n, nil
+}
+
+func loadWebhook(ctx context.Context, name string) (Webhook, error) {
+	key := "notify.webhooks." + name
+	u, err := resolveSecret(ctx, key+".url")
+	if err != nil {
+		return Webhook{}, err
+	}
+	if u == "" {
+		return Webhook{}, errors.New("url can't be empty")
+	}
+
+	w := Webhook{
+		Name: name,
+		URL:  u,
+		Type: WebhookType(viper.GetString(key + ".type")),
+	}
+	switch w.Type {
+	case "":
+		w.Type = WebhookJSON
+	case WebhookJSON, WebhookSlack, WebhookMattermost, WebhookTeams:
+	default:
+		return Webhook{}, fmt.Errorf("type %q invalid, must be one of json, slack, mattermost or teams", w.Type)
+	}
+
+	for _, e := range viper.GetStringSlice(key + ".events") {
+		if !isEventType(EventType(e)) {
+			return Webhook{}, fmt.Errorf("event %q invalid", e)
+		}
+		w.Events = append(w.Events, EventType(e))
+	}
+
+	if text := viper.GetString(key + ".template"); text != "" {
+		w.template, err = template.New(name).Funcs(notifyFuncs).Parse(text)
+		if err != nil {
+			return Webhook{}, fmt.Errorf("template: %w", err)
+		}
+	}
+
+	return w, nil
+}
+
+func isEventType(t EventType) bool {
+	for _, e := range EventTypes {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify post the event to the subscribed webhooks. Failed notifications
+// are logged and never stop the migration.
+func (n *notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+
+	for _, w := range n.webhooks {
+		if !w.accepts(e.Type) {
+			continue
+		}
+		logger := n.logger.With("webhook", w.Name, "event", e.Type)
+		if err := n.send(w, e); err != nil {
+			logger.Warn("send notification error", "error", err)
+			continue
+		}
+		logger.Debug("notification sent")
+	}
+}
+
+func (n *notifier) send(w Webhook, e Event) error {
+	tmpl := w.template
+	if tmpl == nil {
+		tmpl = n.templates[e.Type]
+	}
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, e); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(payload(w.Type, e, text.String()))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// payload build the request body of the webhook type
+func payload(t WebhookType, e Event, text string) interface{} {
+	switch t {
+	case WebhookSlack, WebhookMattermost:
+		return map[string]string{"text": text}
+	case WebhookTeams:
+		color := "0366d6"
+		switch e.Type {
+		case EventRunFinish, EventProjectFinish:
+			color = "2cbe4e"
+		case EventRunFailure, EventProjectFailure:
+			color = "d73a49"
+		}
+		// teams markdown needs an empty line for line breaks
+		return map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    strings.SplitN(text, "\n", 2)[0],
+			"themeColor": color,
+			"text":       strings.ReplaceAll(text, "\n", "\n\n"),
+		}
+	}
+
+	return struct {
+		Event
+		Text string `json:"text"`
+	}{e, text}
+}
@@ -0,0 +1,254 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progress terminal progress view of the run. The overall and the
+// repository bars are redrawn below the log lines, so the logger has
+// to write through the view.
+type progress struct {
+	mu    sync.Mutex
+	out   *os.File
+	lines int
+	stop  chan struct{}
+
+	start  time.Time
+	total  int
+	done   int
+	failed int
+
+	source    string
+	target    string
+	repoStart time.Time
+	step      string
+	stepIndex int
+	steps     int
+	phase     string
+	percent   int
+}
+
+// newProgress creates the progress view, returns nil if the output
+// isn't a terminal.
+func newProgress(out *os.File) *progress {
+	if !term.IsTerminal(int(out.Fd())) {
+		return nil
+	}
+	return &progress{out: out, percent: -1}
+}
+
+type progressKey struct{}
+
+// withProgress add the progress view to the context for the git commands
+func withProgress(ctx context.Context, p *progress) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+func progressFrom(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+	return p
+}
+
+// Write print the log line above the bars
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	n, err := p.out.Write(b)
+	p.draw()
+	return n, err
+}
+
+// Start show the bars and refresh the elapsed time and ETA every second
+func (p *progress) Start(total int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.start = time.Now()
+	p.total = total
+	stop := make(chan struct{})
+	p.stop = stop
+	p.redraw()
+	p.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.redraw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// Stop keep the final overall bar and release the terminal
+func (p *progress) Stop() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	p.source = ""
+	p.redraw()
+	p.lines = 0
+	p.stop = nil
+}
+
+// StartRepo show the repository bar
+func (p *progress) StartRepo(e ManifestEntry) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.source = e.Source()
+	p.target = e.Target()
+	p.repoStart = time.Now()
+	p.step = ""
+	p.stepIndex = 0
+	p.steps = 0
+	p.phase = ""
+	p.percent = -1
+	p.redraw()
+}
+
+// Step show the current step of the repository
+func (p *progress) Step(name string, index, count int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.step = name
+	p.stepIndex = index
+	p.steps = count
+	p.phase = ""
+	p.percent = -1
+	p.redraw()
+}
+
+// Transfer show the git progress of the current step
+func (p *progress) Transfer(phase string, percent int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = phase
+	p.percent = percent
+	p.redraw()
+}
+
+// FinishRepo count the repository and hide its bar
+func (p *progress) FinishRepo(err error) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if err != nil && !errors.Is(err, errSkipped) && !errors.Is(err, errBlocked) {
+		p.failed++
+	}
+	p.source = ""
+	p.redraw()
+}
+
+func (p *progress) redraw() {
+	p.clear()
+	p.draw()
+}
+
+// clear erase the bars, the cursor is below the last bar
+func (p *progress) clear() {
+	if p.lines > 0 {
+		fmt.Fprintf(p.out, "\x1b[%dA\x1b[J", p.lines)
+		p.lines = 0
+	}
+}
+
+func (p *progress) draw() {
+	// only drawn while the run is active
+	if p.stop == nil {
+		return
+	}
+
+	width := 80
+	if w, _, err := term.GetSize(int(p.out.Fd())); err == nil && w > 0 {
+		width = w
+	}
+
+	elapsed := time.Since(p.start)
+	overall := fmt.Sprintf("%s %d/%d repos", bar(p.done, p.total, 30), p.done, p.total)
+	if p.failed > 0 {
+		overall += fmt.Sprintf(", %d failed", p.failed)
+	}
+	overall += ", elapsed " + formatDuration(elapsed)
+	if p.done > 0 && p.done < p.total {
+		eta := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+		overall += ", ETA " + formatDuration(eta)
+	}
+	lines := []string{overall}
+
+	if p.source != "" {
+		repo := fmt.Sprintf("%s %s -> %s", bar(p.stepIndex, p.steps, 20), p.source, p.target)
+		if p.step != "" {
+			repo += fmt.Sprintf(", step %d/%d %s", p.stepIndex+1, p.steps, p.step)
+		}
+		if p.percent >= 0 {
+			repo += fmt.Sprintf(" (%s %d%%)", strings.ToLower(p.phase), p.percent)
+		}
+		repo += ", " + formatDuration(time.Since(p.repoStart))
+		lines = append(lines, repo)
+	}
+
+	for _, line := range lines {
+		if len(line) >= width {
+			line = line[:width-1]
+		}
+		fmt.Fprintln(p.out, line)
+	}
+	p.lines = len(lines)
+}
+
+// bar render the progress bar of the fraction
+func bar(value, total, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = min(width, value*width/total)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter token bucket limiter shared by all requests to the server
+type rateLimiter struct {
+	limiter  *rate.Limiter
+	server   string
+	waits    atomic.Int64
+	waitTime atomic.Int64
+}
+
+// newRateLimiter creates the rate limiter from config with the given prefix.
+// it returns nil when the rate limit is disabled.
+func newRateLimiter(prefix string) *rateLimiter {
+	rps := viper.GetFloat64(prefix + ".rate-limit.rps")
+	if rps <= 0 {
+		return nil
+	}
+
+	burst := viper.GetInt(prefix + ".rate-limit.burst")
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		limiter: rate.NewLimiter(rate.Limit(rps), burst),
+		server:  prefix,
+	}
+}
+
+// Wait blocks until the request is allowed and records the time spent waiting
+func (r *rateLimiter) Wait(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	start := time.Now()
+	err := r.limiter.Wait(ctx)
+	if wait := time.Since(start); wait > time.Millisecond {
+		r.waits.Add(1)
+		r.waitTime.Add(int64(wait))
+		rateLimitWaits.WithLabelValues(r.server).Inc()
+		rateLimitWaitSeconds.WithLabelValues(r.server).Add(wait.Seconds())
+	}
+
+	return err
+}
+
+// RateLimitStats rate limit wait statistics
+type RateLimitStats struct {
+	Waits    int64
+	WaitTime time.Duration
+}
+
+// Stats get the rate limit wait statistics
+func (r *rateLimiter) Stats() RateLimitStats {
+	if r == nil {
+		return RateLimitStats{}
+	}
+
+	return RateLimitStats{
+		Waits:    r.waits.Load(),
+		WaitTime: time.Duration(r.waitTime.Load()),
+	}
+}
@@ -0,0 +1,207 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	gsdk "code.gitea.io/sdk/gitea"
+	"github.com/hashicorp/go-version"
+)
+
+// ReleaseOption create gitea releases from the tags
+type ReleaseOption struct {
+	// Pattern glob pattern of the release tags, e.g. v*, empty disables releases
+	Pattern string
+	// Changelog add the commit subjects since the previous release tag
+	Changelog bool
+}
+
+// releaseTag tag used as release
+type releaseTag struct {
+	Name string
+	// Message the message of the annotated tag
+	Message   string
+	Annotated bool
+	Version   *version.Version
+}
+
+// CreateReleaseOption create release option
+type CreateReleaseOption struct {
+	TagName    string
+	Title      string
+	Note       string
+	Prerelease bool
+}
+
+// CreateRelease create the release of the existing tag
+func (g *gitea) CreateRelease(owner, name string, opts CreateReleaseOption) (*gsdk.Release, error) {
+	release, _, err := g.client.CreateRelease(owner, name, gsdk.CreateReleaseOption{
+		TagName:      opts.TagName,
+		Title:        opts.Title,
+		Note:         opts.Note,
+		IsPrerelease: opts.Prerelease,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// GetReleaseByTag get the release of the tag, returns nil if it doesn't exist
+func (g *gitea) GetReleaseByTag(owner, name, tag string) (*gsdk.Release, error) {
+	release, resp, err := g.client.GetReleaseByTag(owner, name, tag)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// migrateReleases create the gitea releases from the bitbucket tags matching
+// the release pattern. Existing releases are kept.
+func (m *migration) migrateReleases(ctx context.Context, opts MigrateNewRepoOption) error {
+	logger := m.repoLogger(opts)
+	dir, err := cloneMetadata(ctx, logger, m.workspace, m.cloneRemote(opts))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	tags, err := releaseTags(ctx, dir, m.release.Pattern)
+	if err != nil {
+		return err
+	}
+	logger.Info("start create releases", "tags", len(tags), "pattern", m.release.Pattern)
+
+	for i, tag := range tags {
+		existing, err := m.Gitea.GetReleaseByTag(opts.Owner, opts.Name, tag.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			logger.Debug("release exists", "tag", tag.Name)
+			continue
+		}
+
+		note := tag.Message
+		if m.release.Changelog && i > 0 {
+			changelog, err := changelog(ctx, dir, tags[i-1].Name, tag.Name)
+			if err != nil {
+				return err
+			}
+			note = strings.TrimSpace(note + "\n\n" + changelog)
+		}
+
+		_, err = m.Gitea.CreateRelease(opts.Owner, opts.Name, CreateReleaseOption{
+			TagName:    tag.Name,
+			Title:      tag.Name,
+			Note:       note,
+			Prerelease: tag.Version != nil && tag.Version.Prerelease() != "",
+		})
+		if err != nil {
+			return fmt.Errorf("create release %s: %w", tag.Name, err)
+		}
+		logger.Info("release created", "tag", tag.Name)
+	}
+
+	return nil
+}
+
+// releaseTags list the tags matching the pattern, ordered by version if all
+// tags are versions, otherwise by the tag date.
+func releaseTags(ctx context.Context, dir, pattern string) ([]releaseTag, error) {
+	out, err := gitOutput(ctx, dir, "for-each-ref", "--sort=creatordate",
+		"--format=%(refname:short)%00%(objecttype)%00%(contents:subject)%0a%0a%(contents:body)%00",
+		"refs/tags")
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []releaseTag{}
+	versions := true
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		name := strings.TrimSpace(fields[i])
+		if ok, _ := path.Match(pattern, name); !ok {
+			continue
+		}
+		tag := releaseTag{
+			Name:      name,
+			Annotated: fields[i+1] == "tag",
+		}
+		if tag.Annotated {
+			tag.Message = stripSignature(fields[i+2])
+		}
+		if v, err := version.NewVersion(name); err == nil {
+			tag.Version = v
+		} else {
+			versions = false
+		}
+		tags = append(tags, tag)
+	}
+
+	if versions {
+		sort.SliceStable(tags, func(i, j int) bool {
+			return tags[i].Version.LessThan(tags[j].Version)
+		})
+	}
+
+	return tags, nil
+}
+
+// changelog list the commit subjects between the tags
+func changelog(ctx context.Context, dir, from, to string) (string, error) {
+	out, err := gitOutput(ctx, dir, "log", "--no-merges", "--format=%s", from+".."+to)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Changes since %s\n\n", from)
+	count := 0
+	for _, subject := range strings.Split(out, "\n") {
+		if subject = strings.TrimSpace(subject); subject == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "- %s\n", subject)
+		count++
+	}
+	if count == 0 {
+		return "", nil
+	}
+
+	return b.String(), nil
+}
+
+// stripSignature remove the pgp signature of the signed tag message
+func stripSignature(message string) string {
+	if i := strings.Index(message, "-----BEGIN PGP SIGNATURE-----"); i >= 0 {
+		message = message[:i]
+	}
+	return strings.TrimSpace(message)
+}
+
+// gitOutput run the git command in the folder and returns the output
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
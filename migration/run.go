@@ -0,0 +1,401 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bitbucketv1 "github.com/gfleury/go-bitbucket-v1"
+)
+
+// Plan resolve the manifest into single repository migrations.
+// All entries are checked before anything is created in gitea: the
+// source projects and repositories must exist, the target names are
+// generated by the naming templates and must follow the gitea rules,
+// and every target repository must be unique.
+func (m *migration) Plan(manifest *Manifest) ([]ManifestEntry, error) {
+	if len(manifest.Repositories) == 0 {
+		return nil, errors.New("manifest has no repositories")
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	projects := map[string]*bitbucketv1.Project{}
+	owners := map[string]string{}
+	errs := []error{}
+	entries := []ManifestEntry{}
+	for _, e := range manifest.Repositories {
+		project, ok := projects[e.ProjectKey]
+		if !ok {
+			p, err := m.Bitbucket.GetProject(e.ProjectKey)
+			if err != nil {
+				errs = append(errs, entryError(e, fmt.Errorf("get project: %w", err)))
+				continue
+			}
+			project = &p
+			projects[e.ProjectKey] = project
+		}
+
+		if e.Mirror && m.transfer == TransferPush {
+			errs = append(errs, entryError(e, errors.New("mirror requires pull transfer mode")))
+		}
+
+		explicitOwner := e.TargetOwner != ""
+		data := NameData{
+			ProjectKey:  project.Key,
+			ProjectName: project.Name,
+		}
+		if e.TargetOwner == "" {
+			owner, err := m.naming.Owner(data)
+			if err != nil {
+				errs = append(errs, entryError(e, fmt.Errorf("owner name: %w", err)))
+				continue
+			}
+			// different projects must not be merged into a generated organization
+			if prev, ok := owners[strings.ToLower(owner)]; ok && prev != e.ProjectKey {
+				errs = append(errs, entryError(e, fmt.Errorf("owner name %q collides with project %s", owner, prev)))
+				continue
+			}
+			owners[strings.ToLower(owner)] = e.ProjectKey
+			e.TargetOwner = owner
+		}
+		if err := validateOwnerName(e.TargetOwner); err != nil {
+			errs = append(errs, entryError(e, err))
+			continue
+		}
+
+		var repos []Repository
+		if e.RepoSlug == "" {
+			list, err := m.Bitbucket.GetRepositories(e.ProjectKey)
+			if err != nil {
+				errs = append(errs, entryError(e, fmt.Errorf("get repositories: %w", err)))
+				continue
+			}
+			repos = list
+		} else {
+			repo, err := m.Bitbucket.GetRepo(e.ProjectKey, e.RepoSlug)
+			if err != nil {
+				errs = append(errs, entryError(e, fmt.Errorf("get repository: %w", err)))
+				continue
+			}
+			repos = append(repos, repo)
+		}
+
+		for _, repo := range repos {
+			entry := e
+			entry.RepoSlug = repo.Slug
+			if repo.Origin != nil && repo.Origin.Project != nil {
+				entry.Origin = repo.Origin.Project.Key + "/" + repo.Origin.Slug
+			}
+			entry.Archived = repo.Archived
+			if entry.Archived && m.archived.Skip {
+				m.Logger.Info("skip archived repository", "source", entry.Source())
+				continue
+			}
+			if entry.Archived && m.archived.Org != "" && !explicitOwner {
+				entry.TargetOwner = m.archived.Org
+			}
+			if entry.TargetName == "" {
+				data.RepoSlug = repo.Slug
+				data.RepoName = repo.Name
+				name, err := m.naming.Repo(data)
+				if err != nil {
+					errs = append(errs, entryError(entry, fmt.Errorf("repo name: %w", err)))
+					continue
+				}
+				entry.TargetName = name
+			}
+			if err := validateRepoName(entry.TargetName); err != nil {
+				errs = append(errs, entryError(entry, err))
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	// gitea names are case insensitive
+	targets := map[string]ManifestEntry{}
+	for _, e := range entries {
+		key := strings.ToLower(e.Target())
+		if prev, ok := targets[key]; ok {
+			errs = append(errs, entryError(e, fmt.Errorf("target %s already used by %s", e.Target(), prev.Source())))
+			continue
+		}
+		targets[key] = e
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return sortForks(entries)
+}
+
+// Migrate run the planned migrations in order. The gitea organization
+// is created with the project permissions before its first repository.
+// Failed repositories are logged and don't stop the run, unless the
+// target exists with the fail conflict policy. The start and the result
+// of the run and of each project are sent to the notification webhooks.
+func (m *migration) Migrate(entries []ManifestEntry) (err error) {
+	projects := map[string]*ProjectResponse{}
+	orgs := map[string]bool{}
+	taken := map[string]bool{}
+	total := map[string]int{}
+	for _, e := range entries {
+		taken[strings.ToLower(e.Target())] = true
+		total[e.ProjectKey]++
+	}
+
+	run := &Event{
+		Type:  EventRunStart,
+		URL:   m.Gitea.server,
+		Total: len(entries),
+		start: time.Now(),
+	}
+	m.notifier.Notify(*run)
+	m.progress.Start(len(entries))
+	events := map[string]*Event{}
+	started := []*Event{}
+	defer func() {
+		m.progress.Stop()
+		if err != nil {
+			run.Error = err.Error()
+			// the projects in progress are stopped with the run
+			for _, project := range started {
+				if !project.done() {
+					project.Error = err.Error()
+					project.finish(EventProjectFinish, EventProjectFailure)
+					m.notifier.Notify(*project)
+				}
+			}
+		}
+		run.finish(EventRunFinish, EventRunFailure)
+		m.notifier.Notify(*run)
+	}()
+
+	// migrated entries by source with the final target, for forks
+	migrated := map[string]ManifestEntry{}
+	for i, e := range entries {
+		// the running repository isn't canceled by the run timeout, but
+		// no new repository is started
+		if err := m.ctx.Err(); err != nil {
+			return fmt.Errorf("run timeout, %d of %d repositories not migrated: %w", len(entries)-i, len(entries), err)
+		}
+
+		project, ok := events[e.ProjectKey]
+		if !ok {
+			project = &Event{
+				Type:    EventProjectStart,
+				Project: e.ProjectKey,
+				Owner:   e.TargetOwner,
+				URL:     m.Gitea.OwnerURL(e.TargetOwner),
+				Total:   total[e.ProjectKey],
+				start:   time.Now(),
+			}
+			events[e.ProjectKey] = project
+			started = append(started, project)
+			m.notifier.Notify(*project)
+		}
+
+		start := time.Now()
+		m.progress.StartRepo(e)
+		err := m.auditBlocked(e)
+		if err == nil {
+			if err := m.createOwner(e, projects, orgs); err != nil {
+				return err
+			}
+			err = m.migrateEntry(&e, taken, migrated)
+		}
+		if errors.Is(err, ErrConflict) {
+			return err
+		}
+		if err != nil && !errors.Is(err, errSkipped) && !errors.Is(err, errBlocked) {
+			m.Logger.Error("migration repository error",
+				"source", e.Source(),
+				"target", e.Target(),
+				"error", err,
+			)
+		}
+		if err == nil {
+			migrated[e.Source()] = e
+		}
+
+		observeRepository(err, start)
+		m.progress.FinishRepo(err)
+		run.count(e, err)
+		project.count(e, err)
+		if project.done() {
+			project.finish(EventProjectFinish, EventProjectFailure)
+			m.notifier.Notify(*project)
+		}
+	}
+
+	if run.Skipped > 0 {
+		m.Logger.Info("repositories skipped", "skipped", run.Skipped, "total", len(entries))
+	}
+	if run.Blocked > 0 {
+		m.Logger.Warn("repositories blocked by audit", "blocked", run.Blocked, "total", len(entries))
+	}
+	if run.Failed > 0 {
+		return fmt.Errorf("%d of %d repositories failed", run.Failed, len(entries))
+	}
+
+	return nil
+}
+
+// auditBlocked check the repository is blocked by the audit report
+func (m *migration) auditBlocked(e ManifestEntry) error {
+	if m.audit == nil {
+		return nil
+	}
+	report, ok := m.audit[e.Source()]
+	if !ok {
+		m.Logger.Warn("repository missing in audit report", "source", e.Source())
+		return nil
+	}
+	if !report.Blocked {
+		return nil
+	}
+
+	m.Logger.Warn("repository blocked by audit",
+		"source", e.Source(),
+		"risk", report.Risk,
+		"findings", len(report.Findings)+report.Omitted,
+	)
+	return errBlocked
+}
+
+// createOwner create the gitea organization of the entry once per project.
+// Projects sharing an organization all add their permissions.
+func (m *migration) createOwner(e ManifestEntry, projects map[string]*ProjectResponse, orgs map[string]bool) error {
+	org := e.ProjectKey + "/" + strings.ToLower(e.TargetOwner)
+	if orgs[org] {
+		return nil
+	}
+
+	project, ok := projects[e.ProjectKey]
+	if !ok {
+		resp, err := m.GetProjectData(e.ProjectKey)
+		if err != nil {
+			return err
+		}
+		project = resp
+		projects[e.ProjectKey] = project
+	}
+
+	err := m.CreateNewOrg(CreateNewOrgOption{
+		Name:        e.TargetOwner,
+		Description: project.Project.Description,
+		Public:      project.Project.Public,
+		Permission:  project.Permission,
+	})
+	if err != nil {
+		return err
+	}
+	orgs[org] = true
+
+	return nil
+}
+
+// migrateEntry migrate the repository of the manifest entry
+func (m *migration) migrateEntry(e *ManifestEntry, taken map[string]bool, migrated map[string]ManifestEntry) error {
+	action, err := m.resolveConflict(e, taken)
+	if err != nil {
+		return err
+	}
+
+	repoResp, err := m.GetRepositoryData(e.ProjectKey, e.RepoSlug)
+	if err != nil {
+		return err
+	}
+
+	cloneAddr, err := m.cloneLink(repoResp.Repository)
+	if err != nil {
+		return err
+	}
+
+	opts := MigrateNewRepoOption{
+		ProjectKey:  e.ProjectKey,
+		RepoSlug:    e.RepoSlug,
+		Owner:       e.TargetOwner,
+		Name:        e.TargetName,
+		CloneAddr:   cloneAddr,
+		Description: repoResp.Repository.Description,
+		Private:     e.Private(repoResp.Repository.Public),
+		Mirror:      e.Mirror,
+		Permission:  repoResp.Permission,
+	}
+	if e.Origin != "" {
+		opts.ForkOf = m.forkParent(*e, migrated)
+	}
+
+	switch action {
+	case ConflictUpdate:
+		err = m.updateRepo(opts)
+	case ConflictRecreate:
+		if err := m.Gitea.DeleteRepo(opts.Owner, opts.Name); err != nil {
+			return fmt.Errorf("delete repository: %w", err)
+		}
+		fallthrough
+	default:
+		err = m.MigrateNewRepo(opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	// archive last, gitea doesn't allow changes of archived repositories
+	if e.Archived {
+		return m.archiveRepo(opts)
+	}
+
+	return nil
+}
+
+// cloneLink get the clone link of the repository for the clone protocol
+func (m *migration) cloneLink(repo Repository) (string, error) {
+	for _, link := range repo.Links.Clone {
+		if link.Name == m.protocol {
+			return link.Href, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s clone link not found", m.protocol)
+}
+
+// forkParent get the migrated parent of the fork, or nil if the fork is
+// migrated as an independent repository.
+func (m *migration) forkParent(e ManifestEntry, migrated map[string]ManifestEntry) *ManifestEntry {
+	parent, ok := migrated[e.Origin]
+	switch {
+	case !ok:
+		m.Logger.Warn("fork parent isn't migrated, migrate as independent repository",
+			"source", e.Source(),
+			"parent", e.Origin,
+		)
+		return nil
+	case e.Mirror:
+		m.Logger.Warn("mirror can't be a fork, migrate as independent repository",
+			"source", e.Source(),
+			"parent", e.Origin,
+		)
+		return nil
+	}
+
+	return &parent
+}
+
+// archiveRepo archive the gitea repository of an archived bitbucket repository
+func (m *migration) archiveRepo(opts MigrateNewRepoOption) error {
+	m.Logger.Info("archive repo",
+		"owner", opts.Owner,
+		"name", opts.Name,
+	)
+	archived := true
+	_, err := m.Gitea.EditRepo(opts.Owner, opts.Name, EditRepoOption{
+		Archived: &archived,
+	})
+	return err
+}
@@ -0,0 +1,83 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// resolveSecret get the secret value of the config key.
+// The plaintext value takes precedence, otherwise the secret is read from
+// one of the sources below, and setting more than one of them is an error.
+//
+//	<key>_file     read the secret from the file
+//	<key>_env      read the secret from the environment variable
+//	<key>_command  run the command and read the secret from the output
+func resolveSecret(ctx context.Context, key string) (string, error) {
+	if v := viper.GetString(key); v != "" {
+		return v, nil
+	}
+
+	file := viper.GetString(key + "_file")
+	env := viper.GetString(key + "_env")
+	command := viper.GetString(key + "_command")
+
+	sources := 0
+	for _, v := range []string{file, env, command} {
+		if v != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", fmt.Errorf("%s: only one of %s_file, %s_env and %s_command can be set", key, key, key, key)
+	}
+
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%s_file: %w", key, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("%s_env: environment variable %s not set", key, env)
+		}
+		return strings.TrimSpace(v), nil
+	case command != "":
+		return runSecretCommand(ctx, key, command)
+	}
+
+	return "", nil
+}
+
+// runSecretCommand run the command by the shell and returns the trimmed output
+func runSecretCommand(ctx context.Context, key, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s_command: %w: %s", key, err, strings.TrimSpace(stderr.String()))
+	}
+
+	v := strings.TrimSpace(string(out))
+	if v == "" {
+		return "", fmt.Errorf("%s_command: empty output", key)
+	}
+
+	return v, nil
+}
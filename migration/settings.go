@@ -0,0 +1,153 @@
+package migration
+
+import (
+	"encoding/json"
+	"net/http"
+
+	gsdk "code.gitea.io/sdk/gitea"
+)
+
+// bitbucket merge strategy ids
+const (
+	strategyMergeCommit     = "no-ff"
+	strategyFastForward     = "ff"
+	strategyFastForwardOnly = "ff-only"
+	strategySquash          = "squash"
+	strategySquashFFOnly    = "squash-ff-only"
+	strategyRebaseMerge     = "rebase-no-ff"
+	strategyRebaseFFOnly    = "rebase-ff-only"
+)
+
+// mergeStyles gitea merge style of the bitbucket merge strategy
+var mergeStyles = map[string]gsdk.MergeStyle{
+	strategyMergeCommit:     gsdk.MergeStyleMerge,
+	strategyFastForward:     gsdk.MergeStyleMerge,
+	strategyFastForwardOnly: gsdk.MergeStyle("fast-forward-only"),
+	strategySquash:          gsdk.MergeStyleSquash,
+	strategySquashFFOnly:    gsdk.MergeStyleSquash,
+	strategyRebaseMerge:     gsdk.MergeStyleRebaseMerge,
+	strategyRebaseFFOnly:    gsdk.MergeStyleRebase,
+}
+
+// MergeStrategy bitbucket pull request merge strategy
+type MergeStrategy struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+}
+
+// PullRequestSettings bitbucket pull request settings of the repository
+type PullRequestSettings struct {
+	MergeConfig struct {
+		DefaultStrategy MergeStrategy   `json:"defaultStrategy"`
+		Strategies      []MergeStrategy `json:"strategies"`
+	} `json:"mergeConfig"`
+	// DeleteSourceBranch delete the source branch after merge by default,
+	// only returned by servers supporting the setting
+	DeleteSourceBranch *bool `json:"deleteSourceBranch"`
+	// merge checks of older servers, replaced by the merge check hooks
+	RequiredApprovers        int  `json:"requiredApprovers"`
+	RequiredAllApprovers     bool `json:"requiredAllApprovers"`
+	RequiredAllTasksComplete bool `json:"requiredAllTasksComplete"`
+	RequiredSuccessfulBuilds int  `json:"requiredSuccessfulBuilds"`
+	UnapproveOnUpdate        bool `json:"unapproveOnUpdate"`
+}
+
+// GetPullRequestSettings get the pull request settings of the repository
+func (b *bitbucket) GetPullRequestSettings(projectKey, repoSlug string) (PullRequestSettings, error) {
+	settings := PullRequestSettings{}
+	response, err := b.apiClient(projectKey, repoSlug).DefaultApi.GetPullRequestSettings(projectKey, repoSlug)
+	if err != nil {
+		return settings, err
+	}
+
+	// the settings are a map of fragments, decode the known ones
+	data, err := json.Marshal(response.Values)
+	if err != nil {
+		return settings, err
+	}
+	err = json.Unmarshal(data, &settings)
+	return settings, err
+}
+
+// GetDefaultBranch get the default branch, returns empty for empty repositories
+func (b *bitbucket) GetDefaultBranch(projectKey, repoSlug string) (string, error) {
+	var branch struct {
+		DisplayID string `json:"displayId"`
+	}
+	// empty repositories return no content
+	resp, err := b.do(projectKey, repoSlug, http.MethodGet, repoPath(projectKey, repoSlug)+"/branches/default", nil, nil, &branch)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return branch.DisplayID, nil
+}
+
+// repoSettings convert the bitbucket settings to the gitea repository options
+func repoSettings(settings PullRequestSettings, defaultBranch string) EditRepoOption {
+	enabled := map[string]bool{}
+	for _, s := range settings.MergeConfig.Strategies {
+		if s.Enabled {
+			enabled[s.ID] = true
+		}
+	}
+
+	allow := func(ids ...string) *bool {
+		v := false
+		for _, id := range ids {
+			v = v || enabled[id]
+		}
+		return &v
+	}
+
+	opts := EditRepoOption{
+		AllowMerge:                    allow(strategyMergeCommit, strategyFastForward),
+		AllowFastForwardOnly:          allow(strategyFastForwardOnly),
+		AllowSquash:                   allow(strategySquash, strategySquashFFOnly),
+		AllowRebase:                   allow(strategyRebaseFFOnly),
+		AllowRebaseMerge:              allow(strategyRebaseMerge),
+		DefaultDeleteBranchAfterMerge: settings.DeleteSourceBranch,
+	}
+	if style, ok := mergeStyles[settings.MergeConfig.DefaultStrategy.ID]; ok {
+		opts.DefaultMergeStyle = &style
+	}
+	if defaultBranch != "" {
+		opts.DefaultBranch = &defaultBranch
+	}
+
+	return opts
+}
+
+// migrateRepoSettings apply the bitbucket default branch and pull request
+// merge settings to the gitea repository.
+func (m *migration) migrateRepoSettings(opts MigrateNewRepoOption) error {
+	logger := m.repoLogger(opts)
+	settings, err := m.Bitbucket.GetPullRequestSettings(opts.ProjectKey, opts.RepoSlug)
+	if err != nil {
+		return err
+	}
+	defaultBranch, err := m.Bitbucket.GetDefaultBranch(opts.ProjectKey, opts.RepoSlug)
+	if err != nil {
+		return err
+	}
+
+	// no strategy configured, keep the gitea defaults
+	if len(settings.MergeConfig.Strategies) == 0 {
+		logger.Debug("no merge strategies found")
+		if defaultBranch == "" {
+			return nil
+		}
+		_, err := m.Gitea.EditRepo(opts.Owner, opts.Name, EditRepoOption{DefaultBranch: &defaultBranch})
+		return err
+	}
+
+	logger.Info("start migrate repo settings",
+		"default_branch", defaultBranch,
+		"default_strategy", settings.MergeConfig.DefaultStrategy.ID,
+	)
+	_, err = m.Gitea.EditRepo(opts.Owner, opts.Name, repoSettings(settings, defaultBranch))
+	return err
+}
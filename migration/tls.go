@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// tlsVersions supported minimum TLS versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOption TLS settings for the server connection
+type TLSOption struct {
+	SkipVerify bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	MinVersion string
+	ServerName string
+}
+
+// loadTLSOption load TLS settings from config with the given prefix
+func loadTLSOption(prefix string) TLSOption {
+	return TLSOption{
+		SkipVerify: viper.GetBool(prefix + ".skip-verify"),
+		CAFile:     viper.GetString(prefix + ".tls.ca-file"),
+		CertFile:   viper.GetString(prefix + ".tls.cert-file"),
+		KeyFile:    viper.GetString(prefix + ".tls.key-file"),
+		MinVersion: viper.GetString(prefix + ".tls.min-version"),
+		ServerName: viper.GetString(prefix + ".tls.server-name"),
+	}
+}
+
+// Config creates the tls config from the settings
+func (o TLSOption) Config() (*tls.Config, error) {
+	certs, err := x509.SystemCertPool()
+	if err != nil {
+		certs = x509.NewCertPool()
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		if !certs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in ca file %s", o.CAFile)
+		}
+	}
+
+	cfg := &tls.Config{
+		RootCAs:            certs,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.SkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if o.MinVersion != "" {
+		version, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls min version %q invalid", o.MinVersion)
+		}
+		cfg.MinVersion = version
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, errors.New("both tls cert file and key file are required")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
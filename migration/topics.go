@@ -0,0 +1,106 @@
+package migration
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	maxTopicLength = 35
+	maxTopics      = 25
+)
+
+// GetRepoLabels get the labels of the repository
+func (b *bitbucket) GetRepoLabels(projectKey, repoSlug string) ([]string, error) {
+	labels := []string{}
+	err := b.paged(projectKey, repoSlug, repoPath(projectKey, repoSlug)+"/labels", nil, 0, func(values json.RawMessage) error {
+		var page []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, v := range page {
+			labels = append(labels, v.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// SetRepoTopics replace the topics of the repository
+func (g *gitea) SetRepoTopics(owner, name string, topics []string) error {
+	_, err := g.client.SetRepoTopics(owner, name, topics)
+	return err
+}
+
+// normalizeTopic convert the label to a gitea topic: lowercase alphanumeric,
+// dash and dot, starting with an alphanumeric character, at most 35 characters.
+func normalizeTopic(label string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(strings.TrimSpace(label)) {
+		switch {
+		case c >= 'a' && c <= 'z' || c >= '0' && c <= '9':
+			b.WriteRune(c)
+			dash = false
+		case c == '.' && b.Len() > 0:
+			b.WriteRune(c)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	topic := b.String()
+	if len(topic) > maxTopicLength {
+		topic = topic[:maxTopicLength]
+	}
+	return strings.TrimRight(topic, "-.")
+}
+
+// repoTopics map and normalize the labels to unique topics. The mapping is
+// applied before the normalization, and labels mapped to empty are dropped.
+func repoTopics(labels []string, mapping map[string]string) []string {
+	topics := []string{}
+	seen := map[string]bool{}
+	for _, label := range labels {
+		if mapped, ok := mapping[strings.ToLower(label)]; ok {
+			label = mapped
+		}
+		topic := normalizeTopic(label)
+		if topic == "" || seen[topic] {
+			continue
+		}
+		seen[topic] = true
+		topics = append(topics, topic)
+	}
+
+	return topics
+}
+
+// migrateRepoTopics set the bitbucket labels as the gitea repository topics
+func (m *migration) migrateRepoTopics(opts MigrateNewRepoOption) error {
+	logger := m.repoLogger(opts)
+	labels, err := m.Bitbucket.GetRepoLabels(opts.ProjectKey, opts.RepoSlug)
+	if err != nil {
+		return err
+	}
+
+	topics := repoTopics(labels, m.topics)
+	if len(topics) == 0 {
+		return nil
+	}
+	if len(topics) > maxTopics {
+		logger.Warn("too many topics, keep the first ones", "topics", len(topics), "max", maxTopics)
+		topics = topics[:maxTopics]
+	}
+
+	logger.Info("start migrate repo topics", "topics", strings.Join(topics, ","))
+	return m.Gitea.SetRepoTopics(opts.Owner, opts.Name, topics)
+}
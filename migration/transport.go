@@ -0,0 +1,215 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// TransportOption http transport option
+type TransportOption struct {
+	MaxRetries int
+	WaitMin    time.Duration
+	WaitMax    time.Duration
+	Timeout    time.Duration
+}
+
+// loadTransportOption load the http transport option from config
+func loadTransportOption() TransportOption {
+	opts := TransportOption{
+		MaxRetries: 3,
+		WaitMin:    time.Second,
+		WaitMax:    30 * time.Second,
+	}
+
+	if viper.IsSet("http.retry.max") {
+		opts.MaxRetries = viper.GetInt("http.retry.max")
+	}
+	if viper.IsSet("http.retry.wait-min") {
+		opts.WaitMin = viper.GetDuration("http.retry.wait-min")
+	}
+	if viper.IsSet("http.retry.wait-max") {
+		opts.WaitMax = viper.GetDuration("http.retry.wait-max")
+	}
+	opts.Timeout = viper.GetDuration("http.timeout")
+
+	return opts
+}
+
+// transport is a http.RoundTripper which retries idempotent requests
+// on 429, 5xx responses and connection resets.
+type transport struct {
+	base    http.RoundTripper
+	opts    TransportOption
+	limiter *rateLimiter
+	server  string
+	logger  *slog.Logger
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryable := isIdempotent(req)
+
+	for attempt := 0; ; attempt++ {
+		// the caller's request must not be modified, every attempt sends a copy
+		r := req.Clone(req.Context())
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("request body can't be rewound for retry")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := t.roundTrip(r)
+		observeRequest(t.server, req.Method, resp, start)
+		if !retryable || attempt >= t.opts.MaxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt, resp)
+		apiRetries.WithLabelValues(t.server).Inc()
+		t.logger.Warn("retry http request",
+			"server", t.server,
+			"method", req.Method,
+			"url", req.URL.Redacted(),
+			"attempt", attempt+1,
+			"wait", wait,
+			"status", statusCode(resp),
+			"error", err,
+		)
+
+		if resp != nil {
+			// drain body so the connection can be reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTrip send a single request with the per-request timeout
+func (t *transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.opts.Timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.opts.Timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff get the wait duration before the next attempt.
+// Retry-After header takes precedence over exponential backoff,
+// both are limited to the max wait.
+func (t *transport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return min(wait, t.opts.WaitMax)
+		}
+	}
+
+	wait := t.opts.WaitMin << attempt
+	if wait <= 0 || wait > t.opts.WaitMax {
+		wait = t.opts.WaitMax
+	}
+
+	// random jitter between half and the whole wait
+	half := wait / 2
+	if half <= 0 {
+		return wait
+	}
+	return half + rand.N(half)
+}
+
+// retryAfter parse the Retry-After header in seconds or http date
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(v); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// isIdempotent check the request method is safe to retry
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// shouldRetry check the response or error is retryable
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, io.EOF)
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= http.StatusInternalServerError
+}
+
+func statusCode(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// cancelBody cancel the request context when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
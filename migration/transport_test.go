@@ -0,0 +1,114 @@
+package migration
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffJitter(t *testing.T) {
+	tr := &transport{opts: TransportOption{WaitMin: time.Second, WaitMax: 10 * time.Second}}
+
+	tests := []struct {
+		attempt int
+		wait    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{63, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := tr.backoff(tt.attempt, nil)
+			if got < tt.wait/2 || got > tt.wait {
+				t.Fatalf("attempt %d: backoff %s, want between %s and %s", tt.attempt, got, tt.wait/2, tt.wait)
+			}
+		}
+	}
+}
+
+func TestBackoffRetryAfter(t *testing.T) {
+	tr := &transport{opts: TransportOption{WaitMin: time.Second, WaitMax: 30 * time.Second}}
+
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"5", 5 * time.Second},
+		{"0", 0},
+		{"3600", 30 * time.Second},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 30 * time.Second},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": []string{tt.header}}}
+		if got := tr.backoff(5, resp); got != tt.want {
+			t.Errorf("Retry-After %q: backoff %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTripRetries(t *testing.T) {
+	tests := []struct {
+		method   string
+		body     string
+		attempts int32
+	}{
+		{http.MethodGet, "", 3},
+		{http.MethodPut, "payload", 3},
+		{http.MethodDelete, "", 3},
+		{http.MethodPost, "payload", 1},
+		{http.MethodPatch, "payload", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				// every retry must send the whole body again
+				if body, _ := io.ReadAll(r.Body); string(body) != tt.body {
+					t.Errorf("attempt %d body %q, want %q", attempts.Load(), body, tt.body)
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: &transport{
+				base:   http.DefaultTransport,
+				opts:   TransportOption{MaxRetries: 2, WaitMin: time.Millisecond, WaitMax: time.Millisecond},
+				server: "test",
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}}
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, server.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("status %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+			}
+			if got := attempts.Load(); got != tt.attempts {
+				t.Errorf("%d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}